@@ -0,0 +1,452 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The names of the configuration files that are searched for, in order.
+var ConfigFileNames = []string{"sleepywolf.yaml", "sleepywolf.yml", "sleepywolf.json"}
+
+// The outputs that can be enabled in a configuration file.
+const (
+	// The Register functions for each resource
+	RoutesOutput = "routes"
+
+	// The RegisterBatch function
+	BatchOutput = "batch"
+)
+
+// The strategies for turning a resource's name into its path.  All of them
+// remove a trailing "Resource" from the struct name first.
+const (
+	// "TodoItemsResource" becomes "todoitems"
+	LowerNaming = "lower"
+
+	// "TodoItemsResource" becomes "todo_items"
+	SnakeNaming = "snake"
+
+	// "TodoItemsResource" becomes "todo-items"
+	KebabNaming = "kebab"
+)
+
+// The orders that resources can be generated in.
+const (
+	// The order that they're declared in the source file
+	SourceOrder = "source"
+
+	// Alphabetical order of their struct names
+	AlphaOrder = "alpha"
+)
+
+// Options controls how code is generated for a package.  Empty fields are
+// inherited from the enclosing section of the configuration file.
+type Options struct {
+	// Prefix for generated URLs, e.g. "/api"
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+
+	// Router that the generated code registers handlers with.  Only "goji"
+	// is currently supported.
+	Router string `yaml:"router,omitempty" json:"router,omitempty"`
+
+	// Strategy for turning resource names into paths
+	Naming string `yaml:"naming,omitempty" json:"naming,omitempty"`
+
+	// The order that resources are generated in
+	Order string `yaml:"order,omitempty" json:"order,omitempty"`
+
+	// The outputs that are generated
+	Outputs []string `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+
+	// If not empty, only these types are considered to be resources
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+
+	// Additional verbs to recognize, or replacements for the default ones
+	Verbs Verbs `yaml:"verbs,omitempty" json:"verbs,omitempty"`
+
+	// Directory of templates that override the built-in ones.  Relative
+	// paths are relative to the configuration file.
+	Templates string `yaml:"templates,omitempty" json:"templates,omitempty"`
+
+	// Plugins to run, with the options to pass to each of them, by name
+	Plugins map[string]string `yaml:"plugins,omitempty" json:"plugins,omitempty"`
+
+	// Options for individual resources, by struct name
+	Resources map[string]ResourceOptions `yaml:"resources,omitempty" json:"resources,omitempty"`
+}
+
+// ResourceOptions overrides the options for a single resource.
+type ResourceOptions struct {
+	// Prefix for this resource's URLs
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty"`
+
+	// Strategy for turning this resource's name into its path
+	Naming string `yaml:"naming,omitempty" json:"naming,omitempty"`
+
+	// Path segment for this resource, which replaces the one derived from
+	// its name
+	Path string `yaml:"path,omitempty" json:"path,omitempty"`
+}
+
+// Config is the contents of a configuration file.  The top-level options
+// apply to every package, and can be overridden for the package in a given
+// directory (relative to the configuration file) in the "packages" section.
+type Config struct {
+	Options `yaml:",inline"`
+
+	Packages map[string]Options `yaml:"packages,omitempty" json:"packages,omitempty"`
+
+	// The directory that the configuration file is in
+	Dir string `yaml:"-" json:"-"`
+}
+
+// DefaultOptions are the options that are used for anything that isn't
+// configured.
+var DefaultOptions = Options{
+	Prefix:  "/api",
+	Router:  "goji",
+	Naming:  LowerNaming,
+	Order:   SourceOrder,
+	Outputs: []string{RoutesOutput},
+}
+
+// Merge returns a copy of the options with every field that is set in other
+// overriding it.  Verbs and resources are combined by name.
+func (o Options) Merge(other Options) (Options, error) {
+	if other.Prefix != "" {
+		o.Prefix = other.Prefix
+	}
+	if other.Router != "" {
+		o.Router = other.Router
+	}
+	if other.Naming != "" {
+		o.Naming = other.Naming
+	}
+	if other.Order != "" {
+		o.Order = other.Order
+	}
+	if other.Outputs != nil {
+		o.Outputs = other.Outputs
+	}
+	if other.Include != nil {
+		o.Include = other.Include
+	}
+	if other.Templates != "" {
+		o.Templates = other.Templates
+	}
+
+	verbs, err := o.Verbs.Merge(other.Verbs)
+	if err != nil {
+		return Options{}, err
+	}
+	o.Verbs = verbs
+
+	plugins := map[string]string{}
+	for name, opts := range o.Plugins {
+		plugins[name] = opts
+	}
+	for name, opts := range other.Plugins {
+		plugins[name] = opts
+	}
+	o.Plugins = plugins
+
+	resources := map[string]ResourceOptions{}
+	for name, r := range o.Resources {
+		resources[name] = r
+	}
+	for name, r := range other.Resources {
+		merged := resources[name]
+		if r.Prefix != "" {
+			merged.Prefix = r.Prefix
+		}
+		if r.Naming != "" {
+			merged.Naming = r.Naming
+		}
+		if r.Path != "" {
+			merged.Path = r.Path
+		}
+		resources[name] = merged
+	}
+	o.Resources = resources
+	return o, nil
+}
+
+// Validate checks that every option that is set has a known value.
+func (o Options) Validate() error {
+	switch o.Router {
+	case "", "goji":
+	default:
+		return fmt.Errorf("unsupported router %q, expected \"goji\"", o.Router)
+	}
+
+	if err := validateNaming(o.Naming); err != nil {
+		return err
+	}
+
+	switch o.Order {
+	case "", SourceOrder, AlphaOrder:
+	default:
+		return fmt.Errorf("unknown order %q, expected %q or %q", o.Order, SourceOrder, AlphaOrder)
+	}
+
+	for _, out := range o.Outputs {
+		if out != RoutesOutput && out != BatchOutput {
+			return fmt.Errorf("unknown output %q, expected %q or %q", out, RoutesOutput, BatchOutput)
+		}
+	}
+
+	for name, r := range o.Resources {
+		if err := validateNaming(r.Naming); err != nil {
+			return fmt.Errorf("resource '%s': %s", name, err)
+		}
+	}
+
+	_, err := Verbs{}.Merge(o.Verbs)
+	return err
+}
+
+func validateNaming(naming string) error {
+	switch naming {
+	case "", LowerNaming, SnakeNaming, KebabNaming:
+		return nil
+	}
+	return fmt.Errorf("unknown naming strategy %q, expected one of: %s, %s, %s",
+		naming, LowerNaming, SnakeNaming, KebabNaming)
+}
+
+// Summary returns a short description of the options that affect the
+// generated code, e.g. "prefix=/api naming=lower order=source outputs=routes".
+// Verbs that aren't built in, and plugins, are listed by name.
+func (o Options) Summary() string {
+	parts := []string{
+		"prefix=" + o.Prefix,
+		"naming=" + o.Naming,
+		"order=" + o.Order,
+		"outputs=" + strings.Join(o.Outputs, ","),
+	}
+	if o.Router != "" && o.Router != "goji" {
+		parts = append(parts, "router="+o.Router)
+	}
+	if len(o.Include) > 0 {
+		parts = append(parts, "include="+strings.Join(o.Include, ","))
+	}
+
+	verbs := []string{}
+	for _, v := range o.Verbs {
+		if _, ok := DefaultVerbs.Lookup(v.Name); !ok {
+			verbs = append(verbs, v.Name)
+		}
+	}
+	if len(verbs) > 0 {
+		parts = append(parts, "verbs="+strings.Join(verbs, ","))
+	}
+
+	plugins := []string{}
+	for name := range o.Plugins {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+	if len(plugins) > 0 {
+		parts = append(parts, "plugins="+strings.Join(plugins, ","))
+	}
+	if o.Templates != "" {
+		parts = append(parts, "templates="+filepath.Base(o.Templates))
+	}
+	return strings.Join(parts, " ")
+}
+
+// HasOutput returns whether the given output is enabled.
+func (o Options) HasOutput(output string) bool {
+	for _, out := range o.Outputs {
+		if out == output {
+			return true
+		}
+	}
+	return false
+}
+
+// Includes returns whether the type with the given name should be considered
+// a resource.
+func (o Options) Includes(name string) bool {
+	if len(o.Include) == 0 {
+		return true
+	}
+	for _, inc := range o.Include {
+		if inc == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ResourcePath returns the path segment for the resource with the given
+// struct name.
+func (o Options) ResourcePath(structName string) string {
+	r := o.Resources[structName]
+	if r.Path != "" {
+		return strings.Trim(r.Path, "/")
+	}
+
+	naming := o.Naming
+	if r.Naming != "" {
+		naming = r.Naming
+	}
+
+	name := strings.TrimSuffix(structName, "Resource")
+	switch naming {
+	case SnakeNaming:
+		return strings.Join(splitWords(name), "_")
+	case KebabNaming:
+		return strings.Join(splitWords(name), "-")
+	}
+	return strings.ToLower(name)
+}
+
+// Splits a camel-cased name into lower-case words, keeping runs of capitals
+// together, so "HTTPLogEntry" becomes "http", "log", "entry".
+func splitWords(name string) []string {
+	runes := []rune(name)
+	words := []string{}
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		upper := unicode.IsUpper(runes[i])
+		if upper && (!unicode.IsUpper(runes[i-1]) ||
+			(i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, strings.ToLower(string(runes[start:])))
+	}
+	return words
+}
+
+// For returns the options for the package in the given directory, which
+// are the top-level options combined with those of the package's section.
+func (c *Config) For(dir string) (Options, error) {
+	opts := c.Options
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return Options{}, err
+	}
+	rel, err := filepath.Rel(c.Dir, abs)
+	if err != nil {
+		return Options{}, err
+	}
+
+	if pkg, ok := c.Packages[filepath.ToSlash(rel)]; ok {
+		opts, err = opts.Merge(pkg)
+		if err != nil {
+			return Options{}, fmt.Errorf("package '%s': %s", rel, err)
+		}
+	}
+	return opts, nil
+}
+
+// FindConfig searches the given directory and each of its parents for a
+// configuration file, and returns its path, or an empty string if there
+// isn't one.
+func FindConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		found := []string{}
+		for _, name := range ConfigFileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				found = append(found, path)
+			}
+		}
+		if len(found) > 1 {
+			return "", fmt.Errorf("found more than one configuration file: %s",
+				strings.Join(found, ", "))
+		}
+		if len(found) == 1 {
+			return found[0], nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads the configuration file at the given path, which is parsed
+// as JSON if it ends with ".json" and YAML otherwise.  Unknown keys are
+// errors.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	config := &Config{}
+	if strings.HasSuffix(path, ".json") {
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(config)
+	} else {
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(config)
+		if errors.Is(err, io.EOF) {
+			// An empty file has no options.
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %s", path, err)
+	}
+
+	if err := config.Options.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	dirs := []string{}
+	for dir := range config.Packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		if err := config.Packages[dir].Validate(); err != nil {
+			return nil, fmt.Errorf("%s: package '%s': %s", path, dir, err)
+		}
+	}
+
+	config.Dir, err = filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	config.Options.Templates = config.resolve(config.Options.Templates)
+	for dir, pkg := range config.Packages {
+		pkg.Templates = config.resolve(pkg.Templates)
+		config.Packages[dir] = pkg
+	}
+	return config, nil
+}
+
+// Returns the given path relative to the configuration file's directory.
+func (c *Config) resolve(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.Dir, path)
+}
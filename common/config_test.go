@@ -0,0 +1,85 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, contents string) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+func TestLoadConfig(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "sleepywolf.yaml"), `
+prefix: /v1
+naming: kebab
+verbs:
+  - {name: Search, method: get, path: collection, suffix: search, hook: BeforeMany}
+packages:
+  api/todos:
+    outputs: [routes, batch]
+    include: [TodoItemsResource]
+    resources:
+      TodoItemsResource: {path: items, prefix: /v2}
+`)
+	pkg := filepath.Join(root, "api", "todos")
+	assert.NoError(t, os.MkdirAll(pkg, 0755))
+
+	path, err := FindConfig(pkg)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(root, "sleepywolf.yaml"), path)
+
+	config, err := LoadConfig(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	opts, err := DefaultOptions.Merge(config.Options)
+	assert.NoError(t, err)
+	assert.Equal(t, "/v1", opts.Prefix)
+	assert.Equal(t, []string{RoutesOutput}, opts.Outputs)
+	assert.Equal(t, "http-log-entries", opts.ResourcePath("HTTPLogEntriesResource"))
+	assert.Equal(t, "GET", opts.Verbs[0].Method)
+
+	pkgOpts, err := config.For(pkg)
+	assert.NoError(t, err)
+	opts, err = DefaultOptions.Merge(pkgOpts)
+	assert.NoError(t, err)
+	assert.True(t, opts.HasOutput(BatchOutput))
+	assert.True(t, opts.Includes("TodoItemsResource"))
+	assert.False(t, opts.Includes("OtherResource"))
+	assert.Equal(t, "items", opts.ResourcePath("TodoItemsResource"))
+	assert.Equal(t, "/v2", opts.Resources["TodoItemsResource"].Prefix)
+	assert.Len(t, opts.Verbs, 1)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name, contents, err string
+	}{
+		{"sleepywolf.yaml", "prefx: /v1\n", "field prefx not found"},
+		{"sleepywolf.json", `{"prefx": "/v1"}`, `unknown field "prefx"`},
+		{"sleepywolf.yaml", "router: chi\n", `unsupported router "chi"`},
+		{"sleepywolf.yaml", "packages: {a: {naming: camel}}\n", `package 'a': unknown naming strategy "camel"`},
+		{"sleepywolf.yaml", "resources: {Foo: {bogus: 1}}\n", "field bogus not found"},
+	} {
+		path := filepath.Join(dir, tc.name)
+		writeFile(t, path, tc.contents)
+		_, err := LoadConfig(path)
+		if assert.Error(t, err, tc.contents) {
+			assert.Contains(t, err.Error(), tc.err)
+		}
+		os.Remove(path)
+	}
+
+	writeFile(t, filepath.Join(dir, "sleepywolf.yaml"), "")
+	writeFile(t, filepath.Join(dir, "sleepywolf.json"), "{}")
+	_, err := FindConfig(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// The number of unchanged lines shown around each change in a diff.
+const diffContext = 3
+
+// The kinds of line in a diff.
+const (
+	diffSame = ' '
+	diffDel  = '-'
+	diffAdd  = '+'
+)
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// Splits text into lines, keeping track of whether the last one is missing a
+// trailing newline.
+func splitLines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(text), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Returns the edits that turn a into b, using the longest common subsequence
+// of their lines.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	ret := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ret = append(ret, diffLine{diffSame, a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			ret = append(ret, diffLine{diffDel, a[i]})
+			i++
+		default:
+			ret = append(ret, diffLine{diffAdd, b[j]})
+			j++
+		}
+	}
+	return ret
+}
+
+// UnifiedDiff returns the changes from a to b in the unified diff format,
+// using the given names for the two files, or an empty string if they're the
+// same.
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	out := &strings.Builder{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", aName, bName)
+
+	// The line numbers in a and b at the start of each diff line.
+	aLine, bLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for k, l := range lines {
+		aLine[k+1], bLine[k+1] = aLine[k], bLine[k]
+		if l.kind != diffAdd {
+			aLine[k+1]++
+		}
+		if l.kind != diffDel {
+			bLine[k+1]++
+		}
+	}
+
+	for k := 0; k < len(lines); {
+		if lines[k].kind == diffSame {
+			k++
+			continue
+		}
+
+		// A hunk runs from some context before this change to some context
+		// after the last change that's close enough to be joined to it.
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := k
+		for end < len(lines) {
+			if lines[end].kind != diffSame {
+				end++
+				continue
+			}
+
+			next := end
+			for next < len(lines) && lines[next].kind == diffSame {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = next
+		}
+
+		fmt.Fprintf(out, "@@ -%s +%s @@\n",
+			hunkRange(aLine[start], aLine[end]-aLine[start]),
+			hunkRange(bLine[start], bLine[end]-bLine[start]))
+		for _, l := range lines[start:end] {
+			out.WriteByte(l.kind)
+			out.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		k = end
+	}
+	return out.String()
+}
+
+// Formats the range of lines in a hunk header, which starts counting from 1,
+// and refers to the line before the hunk if it's empty.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,40 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Equal(t, "", UnifiedDiff("a", "b", []byte("x\ny\n"), []byte("x\ny\n")))
+
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\n16\n"
+	assert.Equal(t, `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,5 +11,5 @@
+ 11
+ 12
+ 13
+-14
+ 15
++16
+`, UnifiedDiff("a", "b", []byte(a), []byte(b)))
+
+	assert.Equal(t, `--- /dev/null
++++ b
+@@ -0,0 +1,2 @@
++x
++y
+\ No newline at end of file
+`, UnifiedDiff("/dev/null", "b", nil, []byte("x\ny")))
+}
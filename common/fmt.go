@@ -2,23 +2,291 @@ package common
 
 import (
 	"bytes"
-	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
 	"io"
-	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
-func GoFmt(dst io.Writer, src io.Reader) error {
-	cmd := exec.Command("gofmt")
-	cmd.Stdin = src
-	cmd.Stdout = dst
+// The number of lines shown before and after the line with a syntax error.
+const syntaxErrorContext = 3
+
+// SyntaxError is returned when generated code can't be parsed.
+type SyntaxError struct {
+	// The template that generated the line with the error, if it's known
+	Template string
+
+	// Position of the error in the generated code, counting from 1
+	Line, Column int
+
+	// Description of the error
+	Msg string
+
+	// The lines around the error, with the line numbers and the erroneous
+	// line marked
+	Context string
+}
+
+func (e *SyntaxError) Error() string {
+	where := fmt.Sprintf("line %d:%d", e.Line, e.Column)
+	if e.Template != "" {
+		where = fmt.Sprintf("template %q, generated %s", e.Template, where)
+	}
+	return fmt.Sprintf("syntax error in generated code (%s): %s\n%s", where, e.Msg, e.Context)
+}
+
+// Returns a SyntaxError for the given error from parsing src, if it is one.
+func newSyntaxError(src []byte, err error) error {
+	list, ok := err.(scanner.ErrorList)
+	if !ok || len(list) == 0 {
+		return err
+	}
+	pos := list[0].Pos
+
+	lines := strings.Split(string(src), "\n")
+	start := pos.Line - 1 - syntaxErrorContext
+	if start < 0 {
+		start = 0
+	}
+	end := pos.Line + syntaxErrorContext
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	context := &strings.Builder{}
+	for i := start; i < end; i++ {
+		marker := "  "
+		if i+1 == pos.Line {
+			marker = "> "
+		}
+		fmt.Fprintf(context, "%s%4d | %s\n", marker, i+1, lines[i])
+	}
+
+	return &SyntaxError{
+		Line:    pos.Line,
+		Column:  pos.Column,
+		Msg:     list[0].Msg,
+		Context: context.String(),
+	}
+}
+
+// Offset returns the byte offset in src of the position of the error.
+func (e *SyntaxError) Offset(src []byte) int {
+	offset := 0
+	for line := 1; line < e.Line; line++ {
+		i := bytes.IndexByte(src[offset:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		offset += i + 1
+	}
+
+	offset += e.Column - 1
+	if offset > len(src) {
+		offset = len(src)
+	}
+	return offset
+}
+
+// Matches the major version at the end of import paths like
+// "gopkg.in/yaml.v3" or "example.com/foo/v2".
+var versionSuffixRe = regexp.MustCompile(`(\.v[0-9]+|/v[0-9]+)$`)
+
+// Returns the name that the package with the given import path is probably
+// referred to by, if it isn't renamed.
+func importName(importPath string) string {
+	name := path.Base(versionSuffixRe.ReplaceAllString(importPath, ""))
+	name = strings.TrimPrefix(name, "go-")
+	return strings.Replace(name, "-", "_", -1)
+}
+
+// Returns the source with the imports that aren't used by the file removed.
+// The lines they're on are removed entirely, rather than the specs being
+// removed from the syntax tree, so that they don't leave blank lines that
+// would split up the import groups.
+func pruneImports(fset *token.FileSet, f *ast.File, src []byte) []byte {
+	used := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+
+	// The ranges of lines to remove, as pairs of positions.
+	remove := [][2]token.Pos{}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+
+		unused := [][2]token.Pos{}
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			importPath, _ := strconv.Unquote(is.Path.Value)
+
+			name := importName(importPath)
+			if is.Name != nil {
+				name = is.Name.Name
+			}
 
-	errOut := new(bytes.Buffer)
-	cmd.Stderr = errOut
+			// Blank and dot imports are used for their side effects or can't
+			// be checked, so they're always kept.
+			if name != "_" && name != "." && !used[name] {
+				unused = append(unused, [2]token.Pos{is.Pos(), is.End()})
+			}
+		}
+
+		if len(unused) == len(gd.Specs) && len(unused) > 0 {
+			remove = append(remove, [2]token.Pos{gd.Pos(), gd.End()})
+		} else {
+			remove = append(remove, unused...)
+		}
+	}
+
+	out := []byte{}
+	last := 0
+	for _, r := range remove {
+		start := fset.Position(r[0]).Offset
+		end := fset.Position(r[1]).Offset
+		start = bytes.LastIndexByte(src[:start], '\n') + 1
+		if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+			end += i + 1
+		} else {
+			end = len(src)
+		}
+
+		out = append(out, src[last:start]...)
+		last = end
+	}
+	return append(out, src[last:]...)
+}
+
+// Returns whether the import path is in the standard library, in the same
+// way as goimports: if its first element doesn't contain a dot.
+func isStdImport(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// Returns the source with the imports in each parenthesized import
+// declaration split into a group for the standard library and one for
+// everything else, like goimports does, so that running it on the output
+// doesn't change it.  Each import is moved along with its comments, and
+// declarations with comments that aren't attached to an import are left
+// alone.
+func groupImports(fset *token.FileSet, f *ast.File, src []byte) []byte {
+	// Returns the offset of the start of the line with the given position,
+	// or of the line after it.
+	lineStart := func(pos token.Pos) int {
+		return bytes.LastIndexByte(src[:fset.Position(pos).Offset], '\n') + 1
+	}
+	lineEnd := func(pos token.Pos) int {
+		end := fset.Position(pos).Offset
+		if i := bytes.IndexByte(src[end:], '\n'); i >= 0 {
+			return end + i + 1
+		}
+		return len(src)
+	}
+
+	out := []byte{}
+	last := 0
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT || !gd.Lparen.IsValid() {
+			continue
+		}
+		start, end := lineEnd(gd.Lparen), lineStart(gd.Rparen)
+		if start > end {
+			continue
+		}
+
+		groups := [2][]byte{}
+		rest := append([]byte{}, src[start:end]...)
+		for _, spec := range gd.Specs {
+			is := spec.(*ast.ImportSpec)
+			specStart, specEnd := is.Pos(), is.End()
+			if is.Doc != nil {
+				specStart = is.Doc.Pos()
+			}
+			if is.Comment != nil {
+				specEnd = is.Comment.End()
+			}
+
+			from, to := lineStart(specStart), lineEnd(specEnd)
+			importPath, _ := strconv.Unquote(is.Path.Value)
+			group := 1
+			if isStdImport(importPath) {
+				group = 0
+			}
+			groups[group] = append(groups[group], src[from:to]...)
+			for i := from; i < to; i++ {
+				rest[i-start] = ' '
+			}
+		}
+		if len(bytes.TrimSpace(rest)) > 0 {
+			continue
+		}
+
+		out = append(out, src[last:start]...)
+		out = append(out, groups[0]...)
+		if len(groups[0]) > 0 && len(groups[1]) > 0 {
+			out = append(out, '\n')
+		}
+		out = append(out, groups[1]...)
+		last = end
+	}
+	return append(out, src[last:]...)
+}
+
+// FormatSource formats Go source in the same way as gofmt, and removes any
+// imports that it doesn't use.  The imports are grouped like goimports
+// groups them (see groupImports).  If the source can't be parsed, the error
+// is a *SyntaxError.
+func FormatSource(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, newSyntaxError(src, err)
+	}
+
+	pruned := pruneImports(fset, f, src)
+	fset = token.NewFileSet()
+	f, err = parser.ParseFile(fset, "", pruned, parser.ParseComments)
+	if err != nil {
+		return nil, newSyntaxError(pruned, err)
+	}
+
+	grouped := groupImports(fset, f, pruned)
+	out, err := format.Source(grouped)
+	if err != nil {
+		return nil, newSyntaxError(grouped, err)
+	}
+	return out, nil
+}
+
+// GoFmt formats the Go source read from src with FormatSource, and writes it
+// to dst.
+func GoFmt(dst io.Writer, src io.Reader) error {
+	in, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
 
-	err := cmd.Run()
+	out, err := FormatSource(in)
 	if err != nil {
-		return errors.New(string(errOut.Bytes()))
+		return err
 	}
 
-	return nil
+	_, err = dst.Write(out)
+	return err
 }
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatSource(t *testing.T) {
+	src := `package foo
+import (
+	"fmt"
+	"regexp"
+	yaml "gopkg.in/yaml.v3"
+	_ "embed"
+	"github.com/zenazn/goji/web"
+)
+func Foo(m *web.Mux) {
+fmt.Println(yaml.Marshal)
+}
+`
+	out, err := FormatSource([]byte(src))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, `package foo
+
+import (
+	_ "embed"
+	"fmt"
+
+	"github.com/zenazn/goji/web"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func Foo(m *web.Mux) {
+	fmt.Println(yaml.Marshal)
+}
+`, string(out))
+}
+
+func TestFormatSourceGroups(t *testing.T) {
+	// Comments move with their imports, and groups that are already split up
+	// stay the same.
+	src := `package foo
+
+import (
+	// The router
+	"github.com/zenazn/goji/web"
+	"net/http" // For handlers
+)
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Foo(m *web.Mux, h http.Handler) {
+	fmt.Println(yaml.Marshal)
+}
+`
+	out, err := FormatSource([]byte(src))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, `package foo
+
+import (
+	"net/http" // For handlers
+
+	// The router
+	"github.com/zenazn/goji/web"
+)
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+func Foo(m *web.Mux, h http.Handler) {
+	fmt.Println(yaml.Marshal)
+}
+`, string(out))
+
+	// Imports are left alone if there are comments that aren't attached to
+	// one of them.
+	src = "package foo\n\nimport (\n\t\"github.com/zenazn/goji/web\"\n\n\t// Loose\n\n\t\"fmt\"\n)\n\nvar _ = fmt.Sprint(web.New)\n"
+	out, err = FormatSource([]byte(src))
+	if assert.NoError(t, err) {
+		assert.Equal(t, src, string(out))
+	}
+}
+
+func TestFormatSourceSyntaxError(t *testing.T) {
+	src := "package foo\n\nfunc Foo() {\n\tbar(\n}\n"
+	_, err := FormatSource([]byte(src))
+
+	syntaxErr, ok := err.(*SyntaxError)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, 5, syntaxErr.Line)
+	assert.Equal(t, 1, syntaxErr.Column)
+	assert.Contains(t, syntaxErr.Context, ">    5 | }\n")
+	assert.Contains(t, syntaxErr.Context, "     4 | \tbar(\n")
+	assert.Equal(t, len(src)-2, syntaxErr.Offset([]byte(src)))
+	assert.Contains(t, err.Error(), "syntax error in generated code (line 5:1)")
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Regular expressions that the well-known ID types expand to.  Any other value
+// returned from a resource's IDType method is used as a regular expression.
+var idTypePatterns = map[string]string{
+	"int":  `[0-9]+`,
+	"uuid": `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+	"slug": `[a-z0-9]+(?:-[a-z0-9]+)*`,
+}
+
+// IDPattern returns the regular expression that an ID of the given type must
+// match.  The returned expression is not anchored.
+func IDPattern(idType string) (string, error) {
+	if p, ok := idTypePatterns[idType]; ok {
+		return p, nil
+	}
+
+	// The pattern is embedded in a larger one, so any anchors are removed.
+	p := strings.TrimSuffix(strings.TrimPrefix(idType, "^"), "$")
+	if p == "" {
+		return "", fmt.Errorf("invalid ID type %q: empty pattern", idType)
+	}
+	if _, err := regexp.Compile(p); err != nil {
+		return "", fmt.Errorf("invalid ID type %q: %s", idType, err)
+	}
+	return p, nil
+}
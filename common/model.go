@@ -0,0 +1,101 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// The version of the model that is sent to plugins.  It's incremented
+// whenever a change is made that existing plugins might not understand.
+const ModelVersion = 1
+
+// PluginRequest is sent as JSON on the standard input of a plugin.
+type PluginRequest struct {
+	// Version of the model, which is always ModelVersion
+	Version int
+
+	// The options given after the plugin's name, e.g. "opts" for
+	// "-plugin name=opts"
+	Options string
+
+	// The packages that code was generated for
+	Packages []PackageModel
+}
+
+// PackageModel describes the resources in a package.
+type PackageModel struct {
+	// Name of the package, e.g. "todos"
+	Name string
+
+	// Import path of the package
+	ImportPath string
+
+	// The input file that the resources were found in
+	File string
+
+	// The resources in the file, in the order that they were found
+	Resources []ResourceModel
+}
+
+// ResourceModel describes a single resource.
+type ResourceModel struct {
+	StructInfo
+
+	// The doc comment of the resource's struct
+	Doc string
+
+	// The doc comments of the resource's handlers, by handler name
+	HandlerDocs map[string]string
+
+	// The routes that the generated code registers for the resource
+	Routes []RouteModel
+}
+
+// RouteModel describes a route that is registered for a handler.
+type RouteModel struct {
+	// HTTP method, e.g. "GET"
+	Method string
+
+	// Path, e.g. "/api/todos/:id"
+	Path string
+
+	// Name of the handler, e.g. "GetOne"
+	Handler string
+}
+
+// PluginResponse is written as JSON on the standard output of a plugin.
+type PluginResponse struct {
+	// If not empty, the plugin failed and no files are written
+	Error string
+
+	// The files to write
+	Files []PluginFile
+}
+
+// PluginFile is a file that a plugin has generated.
+type PluginFile struct {
+	// Name of the file, relative to the directory of the input file
+	Name string
+
+	// Contents of the file
+	Content string
+}
+
+// ReadPluginRequest reads the request that a plugin receives, and fails if
+// the plugin doesn't understand its version.
+func ReadPluginRequest(r io.Reader) (*PluginRequest, error) {
+	req := &PluginRequest{}
+	if err := json.NewDecoder(r).Decode(req); err != nil {
+		return nil, err
+	}
+	if req.Version != ModelVersion {
+		return nil, fmt.Errorf("unsupported model version %d, expected %d", req.Version, ModelVersion)
+	}
+	return req, nil
+}
+
+// WritePluginResponse writes the response of a plugin.
+func WritePluginResponse(w io.Writer, resp *PluginResponse) error {
+	return json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadPluginRequest(t *testing.T) {
+	req, err := ReadPluginRequest(strings.NewReader(`{"Version": 1, "Options": "a=b",
+		"Packages": [{"Name": "todos", "Resources": [{"StructName": "TodosResource",
+		"Routes": [{"Method": "GET", "Path": "/api/todos", "Handler": "GetMany"}]}]}]}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "a=b", req.Options)
+		assert.Equal(t, "TodosResource", req.Packages[0].Resources[0].StructName)
+		assert.Equal(t, "/api/todos", req.Packages[0].Resources[0].Routes[0].Path)
+	}
+
+	_, err = ReadPluginRequest(strings.NewReader(`{"Version": 2}`))
+	assert.EqualError(t, err, "unsupported model version 2, expected 1")
+}
+
+func TestWritePluginResponse(t *testing.T) {
+	buf := bytes.Buffer{}
+	err := WritePluginResponse(&buf, &PluginResponse{
+		Files: []PluginFile{{Name: "perms.txt", Content: "GET /api/todos\n"}},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"Error": "", "Files": [{"Name": "perms.txt", "Content": "GET /api/todos\n"}]}`,
+		buf.String())
+}
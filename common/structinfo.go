@@ -3,6 +3,23 @@ package common
 type FuncInfo struct {
 	Name   string
 	Params int
+	Typed  bool
+}
+
+type FilterField struct {
+	Name string
+	Type string
+}
+
+type FilterInfo struct {
+	Fields []FilterField
+	Sort   []string
+}
+
+type PageInfo struct {
+	DefaultLimit int
+	MaxLimit     int
+	Envelope     bool
 }
 
 type StructInfo struct {
@@ -11,5 +28,13 @@ type StructInfo struct {
 	BeforeOne  *FuncInfo
 	BeforeMany *FuncInfo
 	BeforeAll  *FuncInfo
+	IDType     string
+	Singleton  bool
+	CORS       bool
+	MediaTypes []string
+	Pagination *PageInfo
+	Filter     *FilterInfo
+	ETag       bool
+	Idempotent bool
 	Warnings   []string
 }
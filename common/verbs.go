@@ -0,0 +1,150 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+)
+
+// The shapes of path that a verb can be registered at.
+const (
+	// The resource's collection, e.g. "/api/foo"
+	CollectionPath = "collection"
+
+	// A single item of the collection, e.g. "/api/foo/:id"
+	ItemPath = "item"
+)
+
+// Verb describes a handler method that sleepywolf recognizes on resources.
+type Verb struct {
+	// Name of the handler method, e.g. "GetOne"
+	Name string `json:"name"`
+
+	// HTTP method that the handler is registered for, e.g. "GET"
+	Method string `json:"method"`
+
+	// Shape of the path that the handler is registered at, which is either
+	// CollectionPath or ItemPath
+	Path string `json:"path"`
+
+	// Optional path segments after the collection or item, e.g. "search"
+	// for "/api/foo/search"
+	Suffix string `json:"suffix,omitempty"`
+
+	// The "Before" function that runs before the handler, in addition to
+	// BeforeAll, e.g. "BeforeOne"
+	Hook string `json:"hook,omitempty"`
+
+	// Status code for successful responses from typed handlers
+	Status int `json:"status,omitempty"`
+}
+
+// Verbs is a table of verbs, in the order that they're checked for.
+type Verbs []Verb
+
+// DefaultVerbs are the verbs that are recognized without any configuration.
+var DefaultVerbs = Verbs{
+	{Name: "DeleteOne", Method: "DELETE", Path: ItemPath, Hook: "BeforeOne", Status: 204},
+	{Name: "DeleteMany", Method: "DELETE", Path: CollectionPath, Hook: "BeforeMany", Status: 204},
+	{Name: "GetMany", Method: "GET", Path: CollectionPath, Hook: "BeforeMany", Status: 200},
+	{Name: "GetOne", Method: "GET", Path: ItemPath, Hook: "BeforeOne", Status: 200},
+	{Name: "Patch", Method: "PATCH", Path: ItemPath, Hook: "BeforeOne", Status: 200},
+	{Name: "PatchMany", Method: "PATCH", Path: CollectionPath, Hook: "BeforeMany", Status: 200},
+	{Name: "Post", Method: "POST", Path: CollectionPath, Hook: "BeforeMany", Status: 201},
+	{Name: "Put", Method: "PUT", Path: ItemPath, Hook: "BeforeOne", Status: 200},
+	{Name: "PutMany", Method: "PUT", Path: CollectionPath, Hook: "BeforeMany", Status: 200},
+}
+
+// The HTTP methods that Goji has a registration function for.
+var gojiMethods = map[string]bool{
+	"CONNECT": true,
+	"DELETE":  true,
+	"GET":     true,
+	"HEAD":    true,
+	"OPTIONS": true,
+	"PATCH":   true,
+	"POST":    true,
+	"PUT":     true,
+	"TRACE":   true,
+}
+
+// Validate checks that the verb is complete and consistent, filling in the
+// default status code if it's missing.
+func (v *Verb) Validate() error {
+	if !token.IsIdentifier(v.Name) || !token.IsExported(v.Name) {
+		return fmt.Errorf("verb name %q is not an exported identifier", v.Name)
+	}
+
+	v.Method = strings.ToUpper(v.Method)
+	if !gojiMethods[v.Method] {
+		return fmt.Errorf("verb '%s' has unsupported method %q", v.Name, v.Method)
+	}
+	if v.Path != CollectionPath && v.Path != ItemPath {
+		return fmt.Errorf("verb '%s' has path %q, expected %q or %q", v.Name, v.Path,
+			CollectionPath, ItemPath)
+	}
+	v.Suffix = strings.Trim(v.Suffix, "/")
+
+	switch v.Hook {
+	case "", "BeforeOne", "BeforeMany":
+	default:
+		return fmt.Errorf("verb '%s' has hook %q, expected \"BeforeOne\" or \"BeforeMany\"", v.Name, v.Hook)
+	}
+
+	if v.Status == 0 {
+		v.Status = 200
+	}
+	return nil
+}
+
+// Lookup returns the verb with the given name.
+func (vs Verbs) Lookup(name string) (Verb, bool) {
+	for _, v := range vs {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Verb{}, false
+}
+
+// Merge returns a copy of the table with the given verbs added to it.  Verbs
+// with the same name as an existing verb replace it.
+func (vs Verbs) Merge(extra Verbs) (Verbs, error) {
+	ret := append(Verbs{}, vs...)
+
+outer:
+	for _, v := range extra {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+
+		for i := range ret {
+			if ret[i].Name == v.Name {
+				ret[i] = v
+				continue outer
+			}
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// LoadVerbs reads a JSON file containing an array of verbs.
+func LoadVerbs(path string) (Verbs, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+
+	verbs := Verbs{}
+	if err := dec.Decode(&verbs); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %s", path, err)
+	}
+	return verbs, nil
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerbsMerge(t *testing.T) {
+	verbs, err := DefaultVerbs.Merge(Verbs{
+		{Name: "Search", Method: "get", Path: CollectionPath, Suffix: "/search/", Hook: "BeforeMany"},
+		{Name: "Post", Method: "POST", Path: CollectionPath, Hook: "BeforeMany", Status: 202},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, verbs, len(DefaultVerbs)+1)
+
+	v, ok := verbs.Lookup("Search")
+	if assert.True(t, ok) {
+		assert.Equal(t, Verb{Name: "Search", Method: "GET", Path: CollectionPath, Suffix: "search",
+			Hook: "BeforeMany", Status: 200}, v)
+	}
+
+	v, _ = verbs.Lookup("Post")
+	assert.Equal(t, 202, v.Status)
+
+	// The defaults aren't modified.
+	v, _ = DefaultVerbs.Lookup("Post")
+	assert.Equal(t, 201, v.Status)
+}
+
+func TestVerbValidate(t *testing.T) {
+	for _, tc := range []struct {
+		verb Verb
+		err  string
+	}{
+		{Verb{Name: "search", Method: "GET", Path: ItemPath}, `verb name "search" is not an exported identifier`},
+		{Verb{Name: "Purge", Method: "PURGE", Path: ItemPath}, `verb 'Purge' has unsupported method "PURGE"`},
+		{Verb{Name: "Head", Method: "HEAD", Path: "member"}, `verb 'Head' has path "member", expected "collection" or "item"`},
+		{Verb{Name: "Head", Method: "HEAD", Path: ItemPath, Hook: "BeforeAll"}, `verb 'Head' has hook "BeforeAll", expected "BeforeOne" or "BeforeMany"`},
+	} {
+		err := tc.verb.Validate()
+		if assert.Error(t, err) {
+			assert.Equal(t, tc.err, err.Error())
+		}
+	}
+}
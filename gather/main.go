@@ -1,6 +1,7 @@
 package gather
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"github.com/zenazn/goji/web"
 
 	"github.com/andrew-d/sleepywolf/common"
+	"github.com/andrew-d/sleepywolf/rest"
 )
 
 type registeredStruct struct {
@@ -19,11 +21,15 @@ type registeredStruct struct {
 
 type InfoGatherer struct {
 	registered []registeredStruct
+
+	// The verbs to check for on each struct
+	Verbs common.Verbs
 }
 
 func NewInfoGatherer() InfoGatherer {
 	return InfoGatherer{
 		registered: []registeredStruct{},
+		Verbs:      common.DefaultVerbs,
 	}
 }
 
@@ -82,6 +88,57 @@ func CheckValidHandler(f interface{}, skipReceiver bool) error {
 	return checkFunctionParams(ty, skipReceiver)
 }
 
+// The signatures of the handlers that have a typed form, not including the
+// receiver.
+var typedHandlers = map[string]reflect.Type{
+	"GetMany": reflect.TypeOf(func(context.Context, rest.PageRequest) (*rest.Page, error) { return nil, nil }),
+	"GetOne":  reflect.TypeOf(func(context.Context) (interface{}, error) { return nil, nil }),
+	"Patch":   reflect.TypeOf(func(context.Context, *rest.Patch) (interface{}, error) { return nil, nil }),
+}
+
+// Returns whether the given function looks like a typed handler, which take a
+// context.Context as their first parameter.
+func isTypedHandler(ty reflect.Type, skipReceiver bool) bool {
+	idx := 0
+	if skipReceiver {
+		idx += 1
+	}
+	return ty.Kind() == reflect.Func && ty.NumIn() > idx &&
+		ty.In(idx) == reflect.TypeOf((*context.Context)(nil)).Elem()
+}
+
+// Checks whether the given function is a valid typed form of the handler with
+// the given name.  Will return nil if it is, otherwise an error specifying why
+// not.
+func CheckValidTypedHandler(name string, f interface{}, skipReceiver bool) error {
+	ty := reflect.TypeOf(f)
+
+	want, ok := typedHandlers[name]
+	if !ok {
+		return fmt.Errorf("there is no typed form of '%s'", name)
+	}
+	if ty.Kind() != reflect.Func {
+		return fmt.Errorf("value is not a function: %s", ty.Kind().String())
+	}
+
+	idx := 0
+	if skipReceiver {
+		idx += 1
+	}
+
+	mismatch := ty.NumIn()-idx != want.NumIn() || ty.NumOut() != want.NumOut()
+	for i := 0; !mismatch && i < want.NumIn(); i++ {
+		mismatch = ty.In(idx+i) != want.In(i)
+	}
+	for i := 0; !mismatch && i < want.NumOut(); i++ {
+		mismatch = ty.Out(i) != want.Out(i)
+	}
+	if mismatch {
+		return fmt.Errorf("typed handler should be of the form '%s'", want.String())
+	}
+	return nil
+}
+
 // Check whether the given function is a valid Before-style function.  Will
 // return nil if it is, otherwise an error specifying why not.
 func CheckValidBeforeFunc(f interface{}, skipReceiver bool) error {
@@ -105,6 +162,40 @@ func CheckValidBeforeFunc(f interface{}, skipReceiver bool) error {
 	return checkFunctionParams(ty, skipReceiver)
 }
 
+// Calls the method with the given name, which should be of the form
+// "func() string", on the instance.  The boolean return value is false if the
+// instance has no such method.
+func callStringMethod(inst interface{}, name string) (string, bool, error) {
+	m := reflect.ValueOf(inst).MethodByName(name)
+	if !m.IsValid() {
+		return "", false, nil
+	}
+
+	ty := m.Type()
+	if ty.NumIn() != 0 || ty.NumOut() != 1 || ty.Out(0).Kind() != reflect.String {
+		return "", true, fmt.Errorf("should be of the form 'func() string', not '%s'", ty.String())
+	}
+
+	return m.Call(nil)[0].String(), true, nil
+}
+
+// Checks for a method with the given name that takes no parameters and returns
+// a single value of the given type.  The boolean return value is false if the
+// type has no such method.
+func checkOptionMethod(ty reflect.Type, name string, ret reflect.Type) (bool, error) {
+	m, ok := ty.MethodByName(name)
+	if !ok {
+		return false, nil
+	}
+
+	// Note: the receiver is the first parameter of the bare function.
+	mty := m.Func.Type()
+	if mty.NumIn() != 1 || mty.NumOut() != 1 || mty.Out(0) != ret {
+		return true, fmt.Errorf("should be of the form 'func() %s'", ret.String())
+	}
+	return true, nil
+}
+
 func (i *InfoGatherer) Register(name string, s interface{}) {
 	i.registered = append(i.registered, registeredStruct{
 		Name: name,
@@ -114,15 +205,6 @@ func (i *InfoGatherer) Register(name string, s interface{}) {
 
 func (i *InfoGatherer) Run(w io.Writer) (err error) {
 	output := []common.StructInfo{}
-	checkMethods := []string{
-		"DeleteOne",
-		"DeleteMany",
-		"GetMany",
-		"GetOne",
-		"Patch",
-		"Post",
-		"Put",
-	}
 
 	for _, s := range i.registered {
 		ty := reflect.TypeOf(s.Inst)
@@ -132,15 +214,37 @@ func (i *InfoGatherer) Run(w io.Writer) (err error) {
 			Warnings:   []string{},
 		}
 
+		// Check whether this is a singleton resource, which is signalled by
+		// the presence of a 'Singleton' method.
+		_, curr.Singleton = ty.MethodByName("Singleton")
+
 		// Check for handler functions.
-		for _, mname := range checkMethods {
+		for _, verb := range i.Verbs {
+			mname := verb.Name
 			method, ok := ty.MethodByName(mname)
 			if !ok {
 				continue
 			}
 
+			// Singleton resources have no collection, so these handlers don't
+			// make sense on them.
+			if curr.Singleton && verb.Path == common.CollectionPath {
+				curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+					"method '%s' is not supported on singleton resources",
+					mname,
+				))
+				continue
+			}
+
 			miface := method.Func.Interface()
-			valid := CheckValidHandler(miface, true)
+			typed := isTypedHandler(method.Type, true)
+
+			var valid error
+			if typed {
+				valid = CheckValidTypedHandler(mname, miface, true)
+			} else {
+				valid = CheckValidHandler(miface, true)
+			}
 			if valid != nil {
 				curr.Warnings = append(curr.Warnings, fmt.Sprintf(
 					"method '%s' is present but invalid: %s",
@@ -154,6 +258,7 @@ func (i *InfoGatherer) Run(w io.Writer) (err error) {
 			curr.Handlers = append(curr.Handlers, common.FuncInfo{
 				Name:   mname,
 				Params: reflect.TypeOf(miface).NumIn() - 1,
+				Typed:  typed,
 			})
 		}
 
@@ -185,6 +290,124 @@ func (i *InfoGatherer) Run(w io.Writer) (err error) {
 		checkBeforeFunc("BeforeMany", &curr.BeforeMany)
 		checkBeforeFunc("BeforeAll", &curr.BeforeAll)
 
+		// Check for the type of ID that this resource uses.
+		idType, has, err := callStringMethod(s.Inst, "IDType")
+		if err == nil && has {
+			_, err = common.IDPattern(idType)
+		}
+		if err != nil {
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'IDType' is present but invalid: %s", err.Error(),
+			))
+		} else {
+			curr.IDType = idType
+		}
+
+		// Check for a CORS policy.
+		curr.CORS, err = checkOptionMethod(ty, "CORS", reflect.TypeOf(rest.CORSPolicy{}))
+		if err != nil {
+			curr.CORS = false
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'CORS' is present but invalid: %s", err.Error(),
+			))
+		}
+
+		// Check for the codecs used for content negotiation.  The media types
+		// are recorded so that they can be documented.
+		has, err = checkOptionMethod(ty, "Codecs", reflect.TypeOf(&rest.Registry{}))
+		if err == nil && has {
+			ret := reflect.ValueOf(s.Inst).MethodByName("Codecs").Call(nil)[0]
+			if reg := ret.Interface().(*rest.Registry); reg != nil {
+				curr.MediaTypes = reg.MediaTypes()
+			}
+			if len(curr.MediaTypes) == 0 {
+				err = fmt.Errorf("no codecs are registered")
+			}
+		}
+		if err != nil {
+			curr.MediaTypes = nil
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'Codecs' is present but invalid: %s", err.Error(),
+			))
+		}
+
+		// Check for pagination, which is enabled by a typed GetMany handler.
+		// The options are recorded so that they end up in the generated code
+		// and documentation.
+		paged := false
+		for _, h := range curr.Handlers {
+			paged = paged || (h.Name == "GetMany" && h.Typed)
+		}
+
+		opts := rest.DefaultPageOptions
+		has, err = checkOptionMethod(ty, "Pagination", reflect.TypeOf(opts))
+		if err == nil && has {
+			if !paged {
+				err = fmt.Errorf("pagination requires a typed GetMany handler")
+			} else {
+				ret := reflect.ValueOf(s.Inst).MethodByName("Pagination").Call(nil)[0]
+				opts = ret.Interface().(rest.PageOptions)
+			}
+		}
+		if err != nil {
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'Pagination' is present but invalid: %s", err.Error(),
+			))
+		}
+		if paged {
+			curr.Pagination = &common.PageInfo{
+				DefaultLimit: opts.DefaultLimit,
+				MaxLimit:     opts.MaxLimit,
+				Envelope:     opts.Envelope,
+			}
+		}
+
+		// Check for an entity tag, which enables conditional requests.
+		curr.ETag, err = checkOptionMethod(ty, "ETag", reflect.TypeOf(""))
+		if err != nil {
+			curr.ETag = false
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'ETag' is present but invalid: %s", err.Error(),
+			))
+		}
+
+		// Check for an idempotency store for the Post handler.
+		curr.Idempotent, err = checkOptionMethod(ty, "IdempotencyStore",
+			reflect.TypeOf((*rest.IdempotencyStore)(nil)).Elem())
+		if err == nil && curr.Idempotent {
+			if _, hasPost := ty.MethodByName("Post"); !hasPost {
+				err = fmt.Errorf("the resource has no Post handler")
+			}
+		}
+		if err != nil {
+			curr.Idempotent = false
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'IdempotencyStore' is present but invalid: %s", err.Error(),
+			))
+		}
+
+		// Check for a filter for the collection.  The query parameters that
+		// it accepts are recorded so that they can be documented.
+		has, err = checkOptionMethod(ty, "Filter", reflect.TypeOf((*interface{})(nil)).Elem())
+		if err == nil && has {
+			filter := reflect.ValueOf(s.Inst).MethodByName("Filter").Call(nil)[0]
+
+			var fields []rest.FilterField
+			info := &common.FilterInfo{}
+			fields, info.Sort, err = rest.DescribeFilter(filter.Interface())
+			for _, f := range fields {
+				info.Fields = append(info.Fields, common.FilterField{Name: f.Name, Type: f.Type})
+			}
+			if err == nil {
+				curr.Filter = info
+			}
+		}
+		if err != nil {
+			curr.Warnings = append(curr.Warnings, fmt.Sprintf(
+				"method 'Filter' is present but invalid: %s", err.Error(),
+			))
+		}
+
 		output = append(output, curr)
 	}
 
@@ -1,11 +1,17 @@
 package gather
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"net/http"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zenazn/goji/web"
+
+	"github.com/andrew-d/sleepywolf/common"
+	"github.com/andrew-d/sleepywolf/rest"
 )
 
 func TestCheckValidHandler(t *testing.T) {
@@ -64,3 +70,80 @@ func TestCheckValidHandler(t *testing.T) {
 	err = CheckValidHandler(func(r int, a http.ResponseWriter, b *http.Request) { return }, true)
 	assert.NoError(t, err)
 }
+
+type idTypeResource struct{}
+
+func (r *idTypeResource) IDType() string { return "int" }
+
+type badIDTypeResource struct{}
+
+func (r *badIDTypeResource) IDType() string { return "[a-z" }
+
+func TestRunIDType(t *testing.T) {
+	g := NewInfoGatherer()
+	g.Register("idTypeResource", &idTypeResource{})
+	g.Register("badIDTypeResource", &badIDTypeResource{})
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, g.Run(buf))
+
+	infos := []common.StructInfo{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &infos))
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, "int", infos[0].IDType)
+		assert.Empty(t, infos[0].Warnings)
+
+		assert.Equal(t, "", infos[1].IDType)
+		assert.Len(t, infos[1].Warnings, 1)
+	}
+}
+
+func TestCheckValidTypedHandler(t *testing.T) {
+	var err error
+
+	err = CheckValidTypedHandler("Put", func(ctx context.Context) {}, false)
+	if assert.Error(t, err, "an error was expected") {
+		assert.Equal(t, err.Error(), "there is no typed form of 'Put'")
+	}
+
+	err = CheckValidTypedHandler("GetMany", func(ctx context.Context) {}, false)
+	if assert.Error(t, err, "an error was expected") {
+		assert.Equal(t, err.Error(), "typed handler should be of the form "+
+			"'func(context.Context, rest.PageRequest) (*rest.Page, error)'")
+	}
+
+	err = CheckValidTypedHandler("GetMany", func(ctx context.Context, p rest.PageRequest) (*rest.Page, error) {
+		return nil, nil
+	}, false)
+	assert.NoError(t, err)
+
+	// Test that the first param is skipped
+	err = CheckValidTypedHandler("GetMany", func(r int, ctx context.Context, p rest.PageRequest) (*rest.Page, error) {
+		return nil, nil
+	}, true)
+	assert.NoError(t, err)
+}
+
+type singletonResource struct{}
+
+func (s *singletonResource) Singleton()                                     {}
+func (s *singletonResource) GetMany(w http.ResponseWriter, r *http.Request) {}
+func (s *singletonResource) GetOne(w http.ResponseWriter, r *http.Request)  {}
+
+func TestRunSingleton(t *testing.T) {
+	g := NewInfoGatherer()
+	g.Register("singletonResource", &singletonResource{})
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, g.Run(buf))
+
+	infos := []common.StructInfo{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &infos))
+	if assert.Len(t, infos, 1) {
+		assert.True(t, infos[0].Singleton)
+		assert.Equal(t, []common.FuncInfo{{Name: "GetOne", Params: 2}}, infos[0].Handlers)
+		assert.Equal(t, []string{
+			"method 'GetMany' is not supported on singleton resources",
+		}, infos[0].Warnings)
+	}
+}
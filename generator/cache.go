@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Returns the directory that gather programs are cached in, or an empty
+// string if they aren't cached.
+func (o Options) cacheDir() (string, error) {
+	if o.NoCache {
+		return "", nil
+	}
+	if o.CacheDir != "" {
+		return o.CacheDir, nil
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("couldn't find cache directory: %s", err)
+	}
+	return filepath.Join(dir, "sleepywolf"), nil
+}
+
+// Returns the flags that gather programs are built with.
+func (o Options) buildFlags() []string {
+	flags := []string{}
+	if len(o.Tags) > 0 {
+		flags = append(flags, "-tags", strings.Join(o.Tags, ","))
+	}
+	if o.Mod != "" {
+		flags = append(flags, "-mod="+o.Mod)
+	}
+	return flags
+}
+
+// Returns the output of "go version", which is part of the cache key because
+// a different toolchain builds a different program.  It's only run once for
+// each model.
+func (m *Model) goVersion() (string, error) {
+	m.goVersionOnce.Do(func() {
+		out, err := exec.Command("go", "version").Output()
+		if err != nil {
+			m.goVersionErr = fmt.Errorf("couldn't run go version: %s", err)
+			return
+		}
+		m.goVersionStr = strings.TrimSpace(string(out))
+	})
+	return m.goVersionStr, m.goVersionErr
+}
+
+// Returns the name of the cached gather program for the given input files and
+// gather program source.  Everything that changes what the program would
+// output is hashed: the input files' fingerprints (which cover their
+// packages' files, their dependencies and the options), the program itself,
+// the Go version, and how it's built.
+func (m *Model) gatherKey(files []*File, src []byte) (string, error) {
+	version, err := m.goVersion()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\n", f.Fingerprint)
+	}
+	fmt.Fprintf(h, "%s\n", version)
+	fmt.Fprintf(h, "%q\n", m.Options.buildFlags())
+	for _, env := range []string{"GOFLAGS", "GOPATH", "GOOS", "GOARCH"} {
+		fmt.Fprintf(h, "%s=%s\n", env, os.Getenv(env))
+	}
+	h.Write(src)
+
+	name := "gather-" + hex.EncodeToString(h.Sum(nil))
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name, nil
+}
@@ -0,0 +1,44 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatherKey(t *testing.T) {
+	f := &File{Path: "todos.go", Fingerprint: "sha256:1234"}
+	src := []byte("package main\n")
+
+	key := func(opts Options) string {
+		m := &Model{Options: opts}
+		k, err := m.gatherKey([]*File{f}, src)
+		assert.NoError(t, err)
+		return k
+	}
+
+	base := key(Options{})
+	assert.Regexp(t, `^gather-[0-9a-f]{64}(\.exe)?$`, base)
+	assert.Equal(t, base, key(Options{}))
+	assert.NotEqual(t, base, key(Options{Tags: []string{"integration"}}))
+	assert.NotEqual(t, base, key(Options{Mod: "vendor"}))
+
+	f.Fingerprint = "sha256:5678"
+	assert.NotEqual(t, base, key(Options{}))
+}
+
+func TestBuildFlags(t *testing.T) {
+	assert.Equal(t, []string{}, Options{}.buildFlags())
+	assert.Equal(t, []string{"-tags", "a,b", "-mod=vendor"},
+		Options{Tags: []string{"a", "b"}, Mod: "vendor"}.buildFlags())
+}
+
+func TestCacheDir(t *testing.T) {
+	dir, err := Options{CacheDir: "/tmp/cache"}.cacheDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/cache", dir)
+
+	dir, err = Options{CacheDir: "/tmp/cache", NoCache: true}.cacheDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "", dir)
+}
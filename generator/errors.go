@@ -0,0 +1,89 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the step of generation that failed.
+type Op string
+
+const (
+	// Parsing an input file
+	OpParse Op = "parse"
+
+	// Finding the import path of an input file
+	OpImportPath = Op("find import path")
+
+	// Building or running the program that gathers information about the
+	// resources in an input file
+	OpGather = Op("gather")
+
+	// Loading or executing the templates for the generated code
+	OpTemplate = Op("execute template")
+
+	// Formatting the generated code
+	OpFormat = Op("format")
+
+	// Running a plugin
+	OpPlugin = Op("run plugin")
+
+	// Writing a generated file
+	OpWrite = Op("write")
+)
+
+// Error is returned when generating code fails.
+type Error struct {
+	// The step that failed
+	Op Op
+
+	// The input file, template directory or plugin that it failed for
+	Path string
+
+	// The underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("couldn't %s: %s", e.Op, e.Err)
+	}
+	return fmt.Sprintf("couldn't %s %s: %s", e.Op, e.Path, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// GatherError is the underlying error of an OpGather Error when the gather
+// program couldn't be built or run.
+type GatherError struct {
+	// Either "build" or "run"
+	Stage string
+
+	// The error from the command
+	Err error
+
+	// What the command printed to stderr, with the positions in the gather
+	// program replaced with the positions in the input file that they came
+	// from, where they're known
+	Output string
+
+	// Path of the gather program's source, which is kept when it fails
+	Source string
+}
+
+func (e *GatherError) Error() string {
+	msg := fmt.Sprintf("couldn't %s gather code: %s", e.Stage, e.Err)
+	if output := strings.TrimRight(e.Output, "\n"); output != "" {
+		msg += "\n" + output
+	}
+	if e.Source != "" {
+		msg += fmt.Sprintf("\n(the gather program was kept in %s)", e.Source)
+	}
+	return msg
+}
+
+func (e *GatherError) Unwrap() error {
+	return e.Err
+}
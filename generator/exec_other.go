@@ -0,0 +1,19 @@
+//go:build !unix
+
+package generator
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// Returns a command that's killed when ctx is done.  On these platforms only
+// the command itself is killed, so anything that it started (like the compiler
+// that "go build" runs) may keep running until it finishes; it stops waiting
+// for their output after a second.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = time.Second
+	return cmd
+}
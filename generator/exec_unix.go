@@ -0,0 +1,23 @@
+//go:build unix
+
+package generator
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Returns a command that runs in its own process group, which is killed when
+// ctx is done.  Killing just the command would leave anything that it started
+// running, like the compiler that "go build" runs, and holding its output open.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	return cmd
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package generator
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandContextKillsGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The shell's child holds its output open, so killing only the shell
+	// would leave Run waiting for the child to finish.
+	out := &bytes.Buffer{}
+	cmd := commandContext(ctx, "sh", "-c", "sleep 30 & wait")
+	cmd.Stdout = out
+	start := time.Now()
+	assert.Error(t, cmd.Run())
+	assert.Less(t, time.Since(start), 900*time.Millisecond)
+}
@@ -0,0 +1,251 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// Version of sleepywolf, which is recorded in the generated files.
+const Version = "0.2.0"
+
+// The prefix of the line in the header of generated files that records the
+// fingerprint of their inputs.
+const fingerprintPrefix = "// Input: "
+
+// Fingerprint returns a hash of everything that the code generated for the
+// given input file depends on: the version of sleepywolf, the options, any
+// templates, the Go files in the input file's package, its module's go.mod and
+// go.sum, and the packages that it imports.  Generated files in the input
+// file's package aren't included, so that the output doesn't change its own
+// fingerprint.
+func Fingerprint(path string, opts Options) (string, error) {
+	dir := filepath.Dir(path)
+
+	h := sha256.New()
+	if err := hashOptions(h, opts); err != nil {
+		return "", err
+	}
+	if err := hashFiles(h, dir, "*.go", true); err != nil {
+		return "", err
+	}
+	if err := hashModule(h, dir); err != nil {
+		return "", err
+	}
+	if err := hashDeps(h, dir, opts); err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Writes the version of sleepywolf, the options and the contents of any
+// templates to w.
+func hashOptions(w io.Writer, opts Options) error {
+	o, err := common.DefaultOptions.Merge(opts.Options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "sleepywolf %s\n", Version)
+
+	// The template directory's path may be different on other machines, so
+	// only its contents are hashed.
+	templates := o.Templates
+	o.Templates = ""
+	if err := json.NewEncoder(w).Encode(o); err != nil {
+		return err
+	}
+
+	if templates != "" {
+		return hashFiles(w, templates, "*.tmpl", false)
+	}
+	return nil
+}
+
+// Writes the names and contents of the files in dir that match the given
+// pattern to w, in order.
+func hashFiles(w io.Writer, dir, pattern string, skipGenerated bool) error {
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if skipGenerated && IsGenerated(contents) {
+			continue
+		}
+
+		fmt.Fprintf(w, "%s %d\n", filepath.Base(file), len(contents))
+		w.Write(contents)
+	}
+	return nil
+}
+
+// Writes the go.mod and go.sum of the module that contains dir to w, if it's
+// in one.
+func hashModule(w io.Writer, dir string) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			if err := hashFiles(w, dir, "go.mod", false); err != nil {
+				return err
+			}
+			return hashFiles(w, dir, "go.sum", false)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// The format of each package that "go list" prints for hashDeps.  Standard
+// library packages are left out, since they're covered by the Go version.
+const depsFormat = `{{if not .Standard}}{{.ImportPath}}{{"\t"}}{{.Dir}}{{"\t"}}` +
+	`{{with .Module}}{{if not .Replace}}{{.Path}}@{{.Version}}{{end}}{{end}}{{"\t"}}` +
+	`{{join .GoFiles " "}} {{join .CgoFiles " "}} {{join .EmbedFiles " "}}{{end}}`
+
+// Returns the packages that the Go files in dir import, other than tests and
+// generated files, in order.
+func packageImports(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	imports := []string{}
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if IsGenerated(contents) {
+			continue
+		}
+
+		// Files that don't parse are hashed anyway, and gathering their
+		// resources will report the error.
+		f, err := parser.ParseFile(fset, file, contents, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range f.Imports {
+			if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+				imports = append(imports, path)
+			}
+		}
+	}
+	sort.Strings(imports)
+	return dedupe(imports), nil
+}
+
+// Writes the packages that the input files in dir import, directly or not, to
+// w.  The generated files' imports aren't included, so that generating the
+// output doesn't change the fingerprint.  Packages from a module with a
+// version can't change, so only the version is written, and the files of any
+// others (e.g. in GOPATH, or replaced with a directory) are written.  If the
+// packages can't be listed, e.g. because dir isn't in a module or GOPATH,
+// nothing is written, since gathering its resources would fail anyway.
+func hashDeps(w io.Writer, dir string, opts Options) error {
+	imports, err := packageImports(dir)
+	if err != nil || len(imports) == 0 {
+		return err
+	}
+
+	args := append([]string{"list", "-e", "-deps", "-f", depsFormat}, opts.buildFlags()...)
+	cmd := exec.Command("go", append(append(args, "--"), imports...)...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.Split(line, "\t")
+		if len(parts) != 4 {
+			continue
+		}
+
+		importPath, pkgDir, version := parts[0], parts[1], parts[2]
+		if version != "" && !strings.HasSuffix(version, "@") {
+			fmt.Fprintf(w, "%s %s\n", importPath, version)
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\n", importPath)
+		for _, name := range strings.Fields(parts[3]) {
+			if err := hashFiles(w, pkgDir, name, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadFingerprint returns the fingerprint that's recorded in the header of a
+// generated file, or an empty string if there isn't one.
+func ReadFingerprint(src []byte) string {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, fingerprintPrefix) {
+			return strings.TrimPrefix(line, fingerprintPrefix)
+		}
+		if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+	}
+	return ""
+}
+
+// UpToDate returns whether the output file for the given input already
+// exists and was generated from inputs with the same fingerprint, in which
+// case generating it again would give the same result.
+func UpToDate(path string, opts Options) (bool, error) {
+	existing, err := os.ReadFile((&File{Path: path}).Output())
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	fingerprint, err := Fingerprint(path, opts)
+	if err != nil {
+		return false, err
+	}
+	return ReadFingerprint(existing) == fingerprint, nil
+}
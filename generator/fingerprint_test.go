@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "todos.go")
+	write := func(name, contents string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	write("todos.go", "package todos\n\ntype TodosResource struct{}\n")
+	write("other.go", "package todos\n")
+	fingerprint, err := Fingerprint(input, Options{})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, fingerprint)
+
+	// Generated files and tests don't change it.
+	write("todos_goji.go", "// Code generated by sleepywolf; DO NOT EDIT.\n// Input: "+fingerprint+"\n\npackage todos\n")
+	write("todos_test.go", "package todos\n")
+	same, err := Fingerprint(input, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, same)
+
+	upToDate, err := UpToDate(input, Options{})
+	assert.NoError(t, err)
+	assert.True(t, upToDate)
+
+	// Other files in the package and the options do.
+	write("other.go", "package todos\n\nfunc (t *TodosResource) GetMany() {}\n")
+	changed, err := Fingerprint(input, Options{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, fingerprint, changed)
+
+	withPrefix, err := Fingerprint(input, Options{Options: common.Options{Prefix: "/v1"}})
+	assert.NoError(t, err)
+	assert.NotEqual(t, changed, withPrefix)
+
+	upToDate, err = UpToDate(input, Options{})
+	assert.NoError(t, err)
+	assert.False(t, upToDate)
+}
+
+func TestFingerprintDeps(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "todos", "todos.go")
+	write := func(name, contents string) {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+	}
+	fingerprint := func() string {
+		fingerprint, err := Fingerprint(input, Options{})
+		assert.NoError(t, err)
+		return fingerprint
+	}
+
+	write("go.mod", "module example.com/m\n\ngo 1.16\n")
+	write("store/store.go", "package store\n\ntype ID int\n")
+	write("todos/todos.go", "package todos\n\nimport \"example.com/m/store\"\n\nfunc (t *TodosResource) IDType() store.ID { return 0 }\n")
+	before := fingerprint()
+
+	// The generated file's imports aren't dependencies of the input.
+	write("todos/todos_goji.go", "// Code generated by sleepywolf; DO NOT EDIT.\n\npackage todos\n\nimport _ \"example.com/m/other\"\n")
+	write("other/other.go", "package other\n")
+	assert.Equal(t, before, fingerprint())
+
+	// But the packages that the input imports and go.mod are.
+	write("store/store.go", "package store\n\ntype ID string\n")
+	changed := fingerprint()
+	assert.NotEqual(t, before, changed)
+
+	write("go.mod", "module example.com/m\n\ngo 1.17\n")
+	assert.NotEqual(t, changed, fingerprint())
+}
+
+func TestGetFileInfoOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.go")
+	assert.NoError(t, os.WriteFile(path, []byte(`package todos
+
+type ZResource struct{}
+
+type (
+	AResource struct{}
+	notAStruct int
+	MResource struct{}
+)
+`), 0644))
+
+	pkg, structs, err := GetFileInfo(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "todos", pkg)
+	assert.Equal(t, []string{"ZResource", "AResource", "MResource"}, structs)
+}
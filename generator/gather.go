@@ -0,0 +1,274 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// A package that a gather program imports, and the name that it's imported as.
+type gatherTarget struct {
+	Alias      string
+	ImportPath string
+}
+
+// A struct that a gather program registers, in the package imported as Alias.
+type gatherStruct struct {
+	Alias string
+	Name  string
+}
+
+// Returns the source of a program that imports the packages of the given
+// files and registers the given structs from each of them, and the positions
+// of the structs keyed by how the program refers to them, like
+// "target.TodosResource".
+func (m *Model) gatherSource(files []*File, structs [][]string) ([]byte, map[string]token.Position, error) {
+	data := struct {
+		Targets []gatherTarget
+		Structs []gatherStruct
+		Verbs   common.Verbs
+	}{Verbs: m.Verbs}
+
+	aliases := map[string]string{}
+	positions := map[string]token.Position{}
+	for i, f := range files {
+		alias, ok := aliases[f.ImportPath]
+		if !ok {
+			alias = "target"
+			if len(aliases) > 0 {
+				alias += strconv.Itoa(len(aliases))
+			}
+			aliases[f.ImportPath] = alias
+			data.Targets = append(data.Targets, gatherTarget{alias, f.ImportPath})
+		}
+
+		for _, name := range structs[i] {
+			data.Structs = append(data.Structs, gatherStruct{alias, name})
+			if pos, ok := f.Positions[name]; ok {
+				positions[alias+"."+name] = pos
+			}
+		}
+	}
+
+	tmpl := template.Must(template.New("gather_gen.go").Parse(gatherTemplate))
+	gatherFile := bytes.Buffer{}
+	if err := tmpl.Execute(&gatherFile, data); err != nil {
+		return nil, nil, fmt.Errorf("couldn't execute template: %s", err)
+	}
+
+	src, err := common.FormatSource(gatherFile.Bytes())
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't format generated code: %s", err)
+	}
+	return src, positions, nil
+}
+
+// Builds and runs a program that imports the packages of the given files and
+// returns information about each of the structs to gather in each file, in
+// the same order.
+func (m *Model) gather(files []*File) (_ [][]common.StructInfo, err error) {
+	// Step 1: Generate a program that will extract information about each of
+	// the structs.
+	structs := [][]string{}
+	for _, f := range files {
+		structs = append(structs, f.structNames)
+	}
+	src, positions, err := m.gatherSource(files, structs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 2: Write it to a temporary file, which is kept if building or
+	// running it fails (see GatherError) so that it can be looked at.
+	tmpDir, err := os.MkdirTemp("", "sleepywolf")
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create temp directory: %s", err)
+	}
+	defer func() {
+		if gatherErr := (*GatherError)(nil); !m.Options.KeepTemp && !errors.As(err, &gatherErr) {
+			os.RemoveAll(tmpDir)
+		}
+	}()
+
+	tmpFile := filepath.Join(tmpDir, "gather_gen.go")
+	m.Options.logf("Temp File     : %s\n", tmpFile)
+	if err := os.WriteFile(tmpFile, src, 0644); err != nil {
+		return nil, fmt.Errorf("couldn't write temp file: %s", err)
+	}
+
+	ctx := context.Background()
+	if m.Options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.Options.Timeout)
+		defer cancel()
+	}
+
+	// Step 3: Find the program in the cache, or build it.
+	binary, err := m.gatherBinary(ctx, files, tmpFile, src, positions)
+	if err != nil {
+		return nil, timeoutError(ctx, m.Options, err)
+	}
+
+	// Step 4: Run it
+	structInfoBuff := bytes.Buffer{}
+	errBuff := bytes.Buffer{}
+	cmd := commandContext(ctx, binary)
+	cmd.Stdout = &structInfoBuff
+	cmd.Stderr = &errBuff
+	err = cmd.Run()
+	if err != nil {
+		return nil, timeoutError(ctx, m.Options, &GatherError{
+			Stage:  "run",
+			Err:    err,
+			Output: mapGatherOutput(errBuff.String(), src, positions),
+			Source: tmpFile,
+		})
+	}
+
+	// Step 5: Deserialize the struct info from the gather file, which is in
+	// the order that the structs were registered.
+	structInfos := []common.StructInfo{}
+	err = json.NewDecoder(&structInfoBuff).Decode(&structInfos)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode json from gather: %s", err)
+	}
+	return splitStructs(structInfos, structs)
+}
+
+// Splits the structs returned from a gather program into the files that
+// registered them.
+func splitStructs(structInfos []common.StructInfo, structs [][]string) ([][]common.StructInfo, error) {
+	count := 0
+	for _, names := range structs {
+		count += len(names)
+	}
+	if len(structInfos) != count {
+		return nil, fmt.Errorf("gather returned %d structs, not %d", len(structInfos), count)
+	}
+
+	split := [][]common.StructInfo{}
+	for _, names := range structs {
+		split = append(split, structInfos[:len(names):len(names)])
+		structInfos = structInfos[len(names):]
+	}
+	return split, nil
+}
+
+// Returns the path of the gather program built from the given source file,
+// building it if it isn't in the cache.
+func (m *Model) gatherBinary(ctx context.Context, files []*File, tmpFile string, src []byte, positions map[string]token.Position) (string, error) {
+	cacheDir, err := m.Options.cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	// When caching, the program is built next to where it's cached, so that
+	// it can be renamed into place without another process seeing it
+	// half-written.
+	binary := filepath.Join(filepath.Dir(tmpFile), "gather")
+	var cached string
+	if cacheDir != "" {
+		name, err := m.gatherKey(files, src)
+		if err != nil {
+			return "", err
+		}
+		cached = filepath.Join(cacheDir, name)
+
+		if _, err := os.Stat(cached); err == nil {
+			m.Options.logf("Gather Cache  : %s\n", cached)
+			return cached, nil
+		}
+
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return "", fmt.Errorf("couldn't create cache directory: %s", err)
+		}
+		tmpBinary, err := common.TempFileWithSuffix(cacheDir, "."+name, ".tmp")
+		if err != nil {
+			return "", fmt.Errorf("couldn't create temp file: %s", err)
+		}
+		tmpBinary.Close()
+		binary = tmpBinary.Name()
+	}
+
+	args := append([]string{"build", "-o", binary}, m.Options.buildFlags()...)
+	errBuff := bytes.Buffer{}
+	cmd := commandContext(ctx, "go", append(args, tmpFile)...)
+	cmd.Stderr = &errBuff
+	if err := cmd.Run(); err != nil {
+		if cached != "" {
+			os.Remove(binary)
+		}
+		return "", &GatherError{
+			Stage:  "build",
+			Err:    err,
+			Output: mapGatherOutput(errBuff.String(), src, positions),
+			Source: tmpFile,
+		}
+	}
+
+	if cached == "" {
+		return binary, nil
+	}
+	if err := os.Rename(binary, cached); err != nil {
+		os.Remove(binary)
+		return "", fmt.Errorf("couldn't cache gather program: %s", err)
+	}
+	m.Options.logf("Gather Cache  : %s (new)\n", cached)
+	return cached, nil
+}
+
+// Returns a clearer error if the given one was caused by the timeout.
+func timeoutError(ctx context.Context, opts Options, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("gather timed out after %s", opts.Timeout)
+	}
+	return err
+}
+
+var (
+	// Matches positions in the gather program in compiler errors and stack
+	// traces, like "/tmp/sleepywolf123/gather_gen.go:20:31"
+	gatherPosRe = regexp.MustCompile(`[^\s:]*gather_gen\.go:([0-9]+)(:[0-9]+)?`)
+
+	// Matches the lines of the gather program that register a struct, and
+	// captures how the program refers to it, like "target.TodosResource"
+	gatherRegisterRe = regexp.MustCompile(`g\.Register\("[^"]*", &(\w+\.\w+)\{`)
+)
+
+// Replaces the positions in the output of the gather program's build or run
+// that are on a line that registers a struct with the position of that struct
+// in its input file (from positions, which is keyed in the same way as
+// gatherSource returns), followed by the original position, e.g.
+// "todos.go:12:6 (gather_gen.go:20:31)".  Other positions are left alone.
+func mapGatherOutput(output string, src []byte, positions map[string]token.Position) string {
+	lines := strings.Split(string(src), "\n")
+
+	return gatherPosRe.ReplaceAllStringFunc(output, func(pos string) string {
+		match := gatherPosRe.FindStringSubmatch(pos)
+		line, _ := strconv.Atoi(match[1])
+		if line < 1 || line > len(lines) {
+			return pos
+		}
+
+		reg := gatherRegisterRe.FindStringSubmatch(lines[line-1])
+		if reg == nil {
+			return pos
+		}
+		input, ok := positions[reg[1]]
+		if !ok {
+			return pos
+		}
+		return fmt.Sprintf("%s (gather_gen.go:%s%s)", input, match[1], match[2])
+	})
+}
@@ -0,0 +1,154 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+func TestMapGatherOutput(t *testing.T) {
+	src := []byte("package main\n\nfunc main() {\n\tg.Register(\"helper\", &target.helper{})\n\tg.Run(os.Stdout)\n}\n")
+	positions := map[string]token.Position{
+		"target.helper": {Filename: "bad.go", Line: 3, Column: 6},
+	}
+
+	out := mapGatherOutput(`# command-line-arguments
+/tmp/sleepywolf123/gather_gen.go:4:31: undefined: target.helper
+/tmp/sleepywolf123/gather_gen.go:5:2: undefined: g
+`, src, positions)
+	assert.Equal(t, `# command-line-arguments
+bad.go:3:6 (gather_gen.go:4:31): undefined: target.helper
+/tmp/sleepywolf123/gather_gen.go:5:2: undefined: g
+`, out)
+
+	out = mapGatherOutput("main.main()\n\t/tmp/sleepywolf123/gather_gen.go:4 +0x1d\n", src, positions)
+	assert.Equal(t, "main.main()\n\tbad.go:3:6 (gather_gen.go:4) +0x1d\n", out)
+}
+
+func TestGatherSource(t *testing.T) {
+	m := &Model{Verbs: common.Verbs{}}
+	files := []*File{
+		{ImportPath: "ex/todos", Positions: map[string]token.Position{"TodosResource": {Filename: "todos.go", Line: 3}}},
+		{ImportPath: "ex/users", Positions: map[string]token.Position{"UsersResource": {Filename: "users.go", Line: 5}}},
+		{ImportPath: "ex/todos"},
+	}
+
+	// Each package is imported once, and the structs are registered in order.
+	src, positions, err := m.gatherSource(files, [][]string{{"TodosResource"}, {"UsersResource"}, {"ItemsResource"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	out := string(src)
+	assert.Contains(t, out, "\ttarget \"ex/todos\"\n")
+	assert.Contains(t, out, "\ttarget1 \"ex/users\"\n")
+	assert.Regexp(t, `(?s)&target\.TodosResource\{\}.*&target1\.UsersResource\{\}.*&target\.ItemsResource\{\}`, out)
+	assert.Equal(t, map[string]token.Position{
+		"target.TodosResource":  {Filename: "todos.go", Line: 3},
+		"target1.UsersResource": {Filename: "users.go", Line: 5},
+	}, positions)
+}
+
+func TestSplitStructs(t *testing.T) {
+	infos := []common.StructInfo{{StructName: "A"}, {StructName: "B"}, {StructName: "C"}}
+	split, err := splitStructs(infos, [][]string{{"A", "B"}, {}, {"C"}})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]common.StructInfo{infos[:2], {}, infos[2:]}, split)
+
+	_, err = splitStructs(infos, [][]string{{"A"}})
+	assert.EqualError(t, err, "gather returned 3 structs, not 1")
+}
+
+func TestGatherError(t *testing.T) {
+	err := error(&Error{OpGather, "bad.go", &GatherError{
+		Stage:  "build",
+		Err:    errors.New("exit status 1"),
+		Output: "bad.go:3:6: undefined: target.helper\n",
+		Source: "/tmp/sleepywolf123/gather_gen.go",
+	}})
+	assert.Equal(t, `couldn't gather bad.go: couldn't build gather code: exit status 1
+bad.go:3:6: undefined: target.helper
+(the gather program was kept in /tmp/sleepywolf123/gather_gen.go)`, err.Error())
+
+	gatherErr := &GatherError{}
+	if assert.True(t, errors.As(err, &gatherErr)) {
+		assert.Equal(t, "build", gatherErr.Stage)
+	}
+}
+
+func TestGetFileDocs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todos.go")
+	assert.NoError(t, os.WriteFile(path, []byte(`package todos
+
+type TodosResource struct{}
+
+// Lists the todos.
+func (t *TodosResource) GetMany() {}
+`), 0644))
+
+	docs, positions, err := GetFileDocs(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"TodosResource.GetMany": "Lists the todos.\n"}, docs)
+	assert.Equal(t, path+":3:6", positions["TodosResource"].String())
+	assert.Equal(t, path+":6:25", positions["TodosResource.GetMany"].String())
+}
+
+// Writes a gather program that doesn't need anything outside the standard
+// library, and returns its path and source.
+func writeGatherProgram(t *testing.T) (string, []byte) {
+	src := []byte("package main\n\nfunc main() {}\n")
+	path := filepath.Join(t.TempDir(), "gather_gen.go")
+	assert.NoError(t, os.WriteFile(path, src, 0644))
+	return path, src
+}
+
+func TestGatherBinaryCache(t *testing.T) {
+	tmpFile, src := writeGatherProgram(t)
+	f := &File{Path: "todos.go", Fingerprint: "sha256:1234"}
+	cacheDir := t.TempDir()
+
+	log := &bytes.Buffer{}
+	m := &Model{Options: Options{CacheDir: cacheDir, Log: log}}
+	binary, err := m.gatherBinary(context.Background(), []*File{f}, tmpFile, src, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, cacheDir, filepath.Dir(binary))
+	assert.Contains(t, log.String(), "(new)")
+
+	// The second time, it's found in the cache.
+	log.Reset()
+	cached, err := m.gatherBinary(context.Background(), []*File{f}, tmpFile, src, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, binary, cached)
+	assert.Equal(t, "Gather Cache  : "+binary+"\n", log.String())
+
+	// -nocache builds it next to the source instead.
+	m = &Model{Options: Options{CacheDir: cacheDir, NoCache: true}}
+	binary, err = m.gatherBinary(context.Background(), []*File{f}, tmpFile, src, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Dir(tmpFile), filepath.Dir(binary))
+	entries, err := os.ReadDir(cacheDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestGatherBinaryTimeout(t *testing.T) {
+	tmpFile, src := writeGatherProgram(t)
+	f := &File{Path: "todos.go", Fingerprint: "sha256:1234"}
+	m := &Model{Options: Options{CacheDir: t.TempDir(), Timeout: time.Nanosecond}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Options.Timeout)
+	defer cancel()
+	_, err := m.gatherBinary(ctx, []*File{f}, tmpFile, src, nil)
+	err = timeoutError(ctx, m.Options, err)
+	assert.EqualError(t, err, "gather timed out after 1ns")
+}
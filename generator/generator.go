@@ -0,0 +1,398 @@
+// Package generator finds the resources in Go source files and generates code
+// that registers them with a router.  It's what the sleepywolf command uses,
+// and can be used by other build tools in the same way:
+//
+//	model, err := generator.Load([]string{"todos.go"}, generator.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	files, err := generator.Generate(model, generator.Goji)
+//
+// Errors are returned as an *Error, which describes the step that failed.
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+var extractFnameRe = regexp.MustCompile(`(.*)(\.go)$`)
+
+// Options controls how resources are loaded and code is generated.
+type Options struct {
+	common.Options
+
+	// Keep the temporary program that gathers information about resources,
+	// rather than removing it once it has run
+	KeepTemp bool
+
+	// If not nil, progress is logged here
+	Log io.Writer
+
+	// Build tags and the -mod flag to build the gather program with.  The
+	// GOFLAGS environment variable is also used.
+	Tags []string
+	Mod  string
+
+	// How long building and running each gather program can take, or zero
+	// for no limit
+	Timeout time.Duration
+
+	// Directory that gather programs are cached in, so that they're only
+	// built again when the input package changes.  If empty, a "sleepywolf"
+	// directory in the user's cache directory is used.
+	CacheDir string
+
+	// Don't cache gather programs
+	NoCache bool
+}
+
+// Model is the information about a set of input files that code is
+// generated from.
+type Model struct {
+	// The options that the model was loaded with, including the defaults for
+	// any that weren't set
+	Options Options
+
+	// The verbs that are recognized, which are the default ones combined with
+	// those in the options
+	Verbs common.Verbs
+
+	// The input files, in the order that they were given
+	Files []*File
+
+	// The output of "go version", which is only found once
+	goVersionOnce sync.Once
+	goVersionStr  string
+	goVersionErr  error
+}
+
+// File is the information about a single input file.
+type File struct {
+	// Path of the input file
+	Path string
+
+	// Name of the package that the file is in
+	PackageName string
+
+	// Import path of the package that the file is in
+	ImportPath string
+
+	// The resources in the file
+	Structs []common.StructInfo
+
+	// The doc comments of the types and methods in the file, keyed by the
+	// type's name, or "Type.Method" for methods
+	Docs map[string]string
+
+	// The positions of the types and methods in the file, keyed in the same
+	// way as Docs
+	Positions map[string]token.Position
+
+	// Hash of everything that the generated code depends on (see
+	// Fingerprint)
+	Fingerprint string
+
+	// The names of the structs to gather information about
+	structNames []string
+}
+
+// Output returns the path of the file that is generated for this input, e.g.
+// "foo_goji.go" for "foo.go".
+func (f *File) Output() string {
+	return extractFnameRe.ReplaceAllString(f.Path, `${1}_goji.go`)
+}
+
+// Backend generates files from a model.
+type Backend interface {
+	// Generate returns the contents of the generated files, keyed by path.
+	Generate(m *Model) (map[string][]byte, error)
+}
+
+// BackendFor returns the backend for the given router.
+func BackendFor(router string) (Backend, error) {
+	switch router {
+	case "", "goji":
+		return Goji, nil
+	}
+	return nil, fmt.Errorf("unsupported router %q", router)
+}
+
+func (o Options) logf(format string, args ...interface{}) {
+	if o.Log != nil {
+		fmt.Fprintf(o.Log, format, args...)
+	}
+}
+
+// Load finds the resources in the input files matching the given patterns,
+// which are file names or globs.
+func Load(patterns []string, opts Options) (*Model, error) {
+	models, errs := LoadAll([]Input{{Patterns: patterns, Options: opts}})
+	return models[0], errs[0]
+}
+
+// Input is a set of input files that are loaded with the same options, like
+// the arguments to Load.
+type Input struct {
+	Patterns []string
+	Options  Options
+
+	// The fingerprints of input files that are already known (see
+	// Fingerprint), keyed by path, which are used rather than finding them
+	// again
+	Fingerprints map[string]string
+}
+
+// LoadAll loads several sets of input files, like calling Load for each of
+// them, but finds all of their resources with one gather program for the
+// inputs that recognize the same verbs and are built the same way (see
+// GatherAll).  The models and errors are in the same order as the inputs,
+// and a model is nil if its input failed.
+func LoadAll(inputs []Input) ([]*Model, []error) {
+	models := make([]*Model, len(inputs))
+	errs := make([]error, len(inputs))
+	for i, input := range inputs {
+		models[i], errs[i] = Parse(input)
+	}
+
+	for i, err := range GatherAll(models) {
+		if err != nil {
+			models[i], errs[i] = nil, err
+		}
+	}
+	return models, errs
+}
+
+// Parse returns a model for the input files, without their resources'
+// information, which GatherAll finds.  It's the first step of Load, and can
+// be called for different inputs at the same time.
+func Parse(input Input) (*Model, error) {
+	opts := input.Options
+	var err error
+	opts.Options, err = common.DefaultOptions.Merge(opts.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Model{Options: opts}
+	m.Verbs, err = common.DefaultVerbs.Merge(opts.Verbs)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := ExpandPatterns(input.Patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	// A fingerprint covers the input file's whole package, so it's only
+	// found once for each directory.
+	fingerprints := map[string]string{}
+	for _, path := range paths {
+		fingerprint, ok := input.Fingerprints[path]
+		if !ok {
+			fingerprint = fingerprints[filepath.Dir(path)]
+		}
+
+		f, err := m.load(path, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		fingerprints[filepath.Dir(path)] = f.Fingerprint
+		m.Files = append(m.Files, f)
+	}
+	return m, nil
+}
+
+// GatherAll finds the information about the resources of the models returned
+// by Parse, which is the second step of Load.  It builds one gather program
+// for the models that recognize the same verbs and are built the same way.
+// If that program fails, each file is gathered on its own, so that errors are
+// only returned for the models that caused them.  The errors are in the same
+// order as the models, and nil models are skipped.
+func GatherAll(models []*Model) []error {
+	errs := make([]error, len(models))
+	groups := map[string][]int{}
+	keys := []string{}
+	for i, m := range models {
+		if m == nil {
+			continue
+		}
+
+		key := m.gatherGroup()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	for _, key := range keys {
+		gatherModels(models, errs, groups[key])
+	}
+	return errs
+}
+
+// Returns a key that's the same for models whose resources can be found by
+// the same gather program, because it's built and run in the same way.
+func (m *Model) gatherGroup() string {
+	return fmt.Sprintf("%#v %q %s %t %q %t", m.Verbs, m.Options.buildFlags(),
+		m.Options.Timeout, m.Options.KeepTemp, m.Options.CacheDir, m.Options.NoCache)
+}
+
+// Gathers the structs of the files in the models with the given indexes,
+// which are in the same group, and records any errors in errs.
+func gatherModels(models []*Model, errs []error, group []int) {
+	files := []*File{}
+	logs := []io.Writer{}
+	for _, i := range group {
+		files = append(files, models[i].Files...)
+		if models[i].Options.Log != nil {
+			logs = append(logs, models[i].Options.Log)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+
+	// The program is logged for every model that it gathers.
+	first := models[group[0]]
+	m := &Model{Options: first.Options, Verbs: first.Verbs}
+	m.Options.Log = nil
+	if len(logs) > 0 {
+		m.Options.Log = io.MultiWriter(logs...)
+	}
+
+	infos, err := m.gather(files)
+	if err == nil {
+		for k, f := range files {
+			f.Structs = infos[k]
+		}
+		return
+	}
+	if len(files) == 1 {
+		errs[group[0]] = &Error{OpGather, files[0].Path, err}
+		return
+	}
+
+	// Find the files that caused the error by gathering each of them on
+	// its own.  The program that gathered them together isn't needed.
+	if gatherErr := (*GatherError)(nil); errors.As(err, &gatherErr) && !m.Options.KeepTemp {
+		os.RemoveAll(filepath.Dir(gatherErr.Source))
+	}
+	for _, i := range group {
+		for _, f := range models[i].Files {
+			infos, err := models[i].gather([]*File{f})
+			if err != nil {
+				errs[i] = &Error{OpGather, f.Path, err}
+				break
+			}
+			f.Structs = infos[0]
+		}
+	}
+}
+
+// ExpandPatterns returns the files matching the given patterns, without any
+// duplicates.  Patterns that don't match anything are returned as-is, so that
+// the error from reading them is reported.  Tests and generated files that
+// match a glob are skipped, so that "*.go" doesn't include the output.
+func ExpandPatterns(patterns []string) ([]string, error) {
+	paths := []string{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			matches = []string{pattern}
+		}
+
+		sort.Strings(matches)
+		for _, path := range matches {
+			if path != pattern && skipMatch(path) {
+				continue
+			}
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// Returns whether a file that matched a glob isn't an input file.
+func skipMatch(path string) bool {
+	if strings.HasSuffix(path, "_test.go") {
+		return true
+	}
+	contents, err := os.ReadFile(path)
+	return err == nil && IsGenerated(contents)
+}
+
+// Loads the information about a single input file, other than its structs'
+// information.  The fingerprint is found unless it's given.
+func (m *Model) load(path, fingerprint string) (*File, error) {
+	inputPath := filepath.ToSlash(path)
+	f := &File{Path: path}
+
+	// Step 1: obtain information about the input file
+	packageName, allStructs, err := GetFileInfo(inputPath)
+	if err != nil {
+		return nil, &Error{OpParse, path, err}
+	}
+	f.PackageName = packageName
+
+	f.Docs, f.Positions, err = GetFileDocs(path)
+	if err != nil {
+		return nil, &Error{OpParse, path, err}
+	}
+
+	for _, s := range allStructs {
+		if m.Options.Includes(s) {
+			f.structNames = append(f.structNames, s)
+		}
+	}
+	if m.Options.Order == common.AlphaOrder {
+		sort.Strings(f.structNames)
+	}
+
+	f.Fingerprint = fingerprint
+	if f.Fingerprint == "" {
+		f.Fingerprint, err = Fingerprint(path, m.Options)
+		if err != nil {
+			return nil, &Error{OpParse, path, err}
+		}
+	}
+
+	m.Options.logf("Package Name  : %s\n", packageName)
+	for _, s := range f.structNames {
+		m.Options.logf("  Struct      : %s\n", s)
+	}
+
+	// Step 2: Find the import path of this file
+	f.ImportPath, err = getImportPath(inputPath)
+	if err != nil {
+		return nil, &Error{OpImportPath, path, err}
+	}
+
+	m.Options.logf("Import Path   : %s\n", f.ImportPath)
+	return f, nil
+}
+
+// Generate generates files from the model with the given backend, and
+// returns their contents keyed by path.
+func Generate(m *Model, b Backend) (map[string][]byte, error) {
+	return b.Generate(m)
+}
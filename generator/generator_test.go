@@ -0,0 +1,347 @@
+package generator
+
+import (
+	"errors"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+func testModel(t *testing.T, opts common.Options) *Model {
+	opts, err := common.DefaultOptions.Merge(opts)
+	assert.NoError(t, err)
+	verbs, err := common.DefaultVerbs.Merge(opts.Verbs)
+	assert.NoError(t, err)
+
+	return &Model{
+		Options: Options{Options: opts},
+		Verbs:   verbs,
+		Files: []*File{{
+			Path:        "todos.go",
+			PackageName: "todos",
+			Structs: []common.StructInfo{{
+				StructName: "TodoItemsResource",
+				IDType:     "int",
+				Handlers: []common.FuncInfo{
+					{Name: "GetMany", Params: 2},
+					{Name: "GetOne", Params: 3},
+				},
+			}},
+		}},
+	}
+}
+
+func TestGenerateGoji(t *testing.T) {
+	m := testModel(t, common.Options{Naming: common.KebabNaming})
+
+	files, err := Generate(m, Goji)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out := string(files["todos_goji.go"])
+	assert.True(t, IsGenerated(files["todos_goji.go"]))
+	assert.Contains(t, out, "// Options: prefix=/api naming=kebab order=source outputs=routes\n")
+	assert.Contains(t, out, "package todos")
+	assert.Contains(t, out, "// RegisterTodoItemsResource registers the handlers of TodoItemsResource with mux.\n")
+	assert.Contains(t, out, "func RegisterTodoItemsResource(mux *web.Mux) {")
+	assert.Contains(t, out, `pattern0 := "/api/todo-items"`)
+	assert.Contains(t, out, `pattern1 := regexp.MustCompile("^/api/todo-items/(?P<id>[0-9]+)$")`)
+	assert.Contains(t, out, "res.GetOne(c, w, r)")
+	assert.Contains(t, out, "mux.Post(pattern1, notAllowed1)")
+	assert.NotContains(t, out, "mux.Get(pattern1, notAllowed1)")
+	assert.NotContains(t, out, "mux.Handle(")
+	assert.NotContains(t, out, "RegisterBatch")
+}
+
+func TestGenerateBeforeFuncs(t *testing.T) {
+	m := testModel(t, common.Options{})
+	s := &m.Files[0].Structs[0]
+	s.BeforeOne = &common.FuncInfo{Name: "BeforeOne", Params: 2}
+	s.BeforeMany = &common.FuncInfo{Name: "BeforeMany", Params: 3}
+
+	files, err := Generate(m, Goji)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Each handler only calls the Before function for its kind of path.
+	out := string(files["todos_goji.go"])
+	getMany := out[strings.Index(out, "handlerForGetMany :="):strings.Index(out, "res.GetMany(")]
+	assert.Contains(t, getMany, "res.BeforeMany(c, w, r)")
+	assert.NotContains(t, getMany, "res.BeforeOne(")
+
+	getOne := out[strings.Index(out, "handlerForGetOne :="):strings.Index(out, "res.GetOne(")]
+	assert.Contains(t, getOne, "res.BeforeOne(w, r)")
+	assert.NotContains(t, getOne, "res.BeforeMany(")
+}
+
+func TestGenerateETag(t *testing.T) {
+	m := testModel(t, common.Options{})
+	s := &m.Files[0].Structs[0]
+	s.ETag = true
+	s.Handlers = append(s.Handlers, common.FuncInfo{Name: "Put", Params: 2}, common.FuncInfo{Name: "Post", Params: 2})
+
+	files, err := Generate(m, Goji)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Only the handlers that change the resource set the ETag of their
+	// response.
+	out := string(files["todos_goji.go"])
+	put := out[strings.Index(out, "handlerForPut :="):strings.Index(out, "res.Put(")]
+	assert.Contains(t, put, "w = rest.ETagWriter(w, res)")
+	assert.Equal(t, 1, strings.Count(out, "rest.ETagWriter("))
+}
+
+func TestGenerateTemplates(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	}
+
+	write("a.tmpl", `{{define "HandlerCall"}}res.{{.Name}}(w, r) // custom{{end}}`)
+	m := testModel(t, common.Options{Templates: dir})
+	files, err := Generate(m, Goji)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, strings.Count(string(files["todos_goji.go"]), "// custom"))
+	}
+
+	write("b.tmpl", `oops`)
+	_, err = Generate(m, Goji)
+	genErr := &Error{}
+	if assert.True(t, errors.As(err, &genErr)) {
+		assert.Equal(t, OpTemplate, genErr.Op)
+		assert.Equal(t, dir, genErr.Path)
+	}
+}
+
+func TestGenerateSyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "a.tmpl"),
+		[]byte(`{{define "HandlerCall"}}res.{{.Name}}(w, r{{end}}`), 0644)
+	assert.NoError(t, err)
+
+	m := testModel(t, common.Options{Templates: dir})
+	_, err = Generate(m, Goji)
+
+	genErr := &Error{}
+	if assert.True(t, errors.As(err, &genErr)) {
+		assert.Equal(t, OpFormat, genErr.Op)
+		assert.Equal(t, "todos_goji.go", genErr.Path)
+	}
+
+	syntaxErr := &common.SyntaxError{}
+	if assert.True(t, errors.As(err, &syntaxErr)) {
+		assert.Equal(t, "HandlerCall", syntaxErr.Template)
+		assert.Contains(t, syntaxErr.Context, "res.GetMany(w, r")
+	}
+}
+
+func TestPathsFor(t *testing.T) {
+	m := testModel(t, common.Options{
+		Verbs: common.Verbs{
+			{Name: "Search", Method: "GET", Path: common.CollectionPath, Suffix: "search"},
+		},
+		Resources: map[string]common.ResourceOptions{
+			"TodoItemsResource": {Prefix: "/v2"},
+		},
+	})
+	h := &helpers{m.Options.Options, m.Verbs}
+
+	s := m.Files[0].Structs[0]
+	s.Handlers = append(s.Handlers, common.FuncInfo{Name: "Search", Params: 2})
+
+	paths, err := h.PathsFor("/api", s)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	patterns := []string{}
+	for _, p := range paths {
+		patterns = append(patterns, p.Pattern)
+	}
+	assert.Equal(t, []string{
+		`"/v2/todoitems/search"`,
+		`"/v2/todoitems"`,
+		`regexp.MustCompile("^/v2/todoitems/(?P<id>[0-9]+)$")`,
+	}, patterns)
+	assert.Equal(t, "GET, HEAD, OPTIONS", paths[0].Allow)
+	assert.Equal(t, []string{"Delete", "Patch", "Post", "Put"}, paths[0].Disallowed)
+}
+
+func TestPathsForSingleton(t *testing.T) {
+	m := testModel(t, common.Options{})
+	h := &helpers{m.Options.Options, m.Verbs}
+
+	s := m.Files[0].Structs[0]
+	s.Singleton = true
+	s.Handlers = []common.FuncInfo{{Name: "GetOne", Params: 2}, {Name: "Put", Params: 2}}
+
+	// Every handler is registered at the resource's path, without an ID.
+	paths, err := h.PathsFor("/api", s)
+	if assert.NoError(t, err) && assert.Len(t, paths, 1) {
+		assert.Equal(t, `"/api/todoitems"`, paths[0].Pattern)
+		assert.Equal(t, "GET, HEAD, OPTIONS, PUT", paths[0].Allow)
+	}
+
+	path, err := h.PathFor("/api", s, "GetOne")
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/todoitems", path)
+}
+
+func TestRouteTableHead(t *testing.T) {
+	m := testModel(t, common.Options{
+		Verbs: common.Verbs{{Name: "HeadOne", Method: "HEAD", Path: common.ItemPath, Hook: "BeforeOne"}},
+	})
+	s := &m.Files[0].Structs[0]
+	s.Handlers = append(s.Handlers, common.FuncInfo{Name: "HeadOne", Params: 3})
+
+	routes, err := RouteTable(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// A HEAD handler answers HEAD requests instead of the GET handler.
+	heads := []string{}
+	for _, route := range routes {
+		if route.Method == "HEAD" {
+			heads = append(heads, route.Path+" "+route.Handler)
+		}
+	}
+	assert.Equal(t, []string{"/api/todoitems/:id HeadOne", "/api/todoitems GetMany"}, heads)
+}
+
+func TestParse(t *testing.T) {
+	gopath := t.TempDir()
+	t.Setenv("GOPATH", gopath)
+	dir := filepath.Join(gopath, "src", "example.com", "todos")
+	assert.NoError(t, os.MkdirAll(dir, 0755))
+	a := filepath.Join(dir, "a.go")
+	b := filepath.Join(dir, "b.go")
+	assert.NoError(t, os.WriteFile(a, []byte("package todos\n\ntype TodosResource struct{}\n"), 0644))
+	assert.NoError(t, os.WriteFile(b, []byte("package todos\n\ntype UsersResource struct{}\n"), 0644))
+
+	m, err := Parse(Input{Patterns: []string{a, b}})
+	if !assert.NoError(t, err) || !assert.Len(t, m.Files, 2) {
+		return
+	}
+	fingerprint, err := Fingerprint(a, m.Options)
+	assert.NoError(t, err)
+	for i, name := range []string{"TodosResource", "UsersResource"} {
+		assert.Equal(t, "example.com/todos", m.Files[i].ImportPath)
+		assert.Equal(t, []string{name}, m.Files[i].structNames)
+		assert.Equal(t, fingerprint, m.Files[i].Fingerprint)
+	}
+
+	// Known fingerprints are used for every file in the same package.
+	m, err = Parse(Input{Patterns: []string{a, b}, Fingerprints: map[string]string{a: "sha256:known"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "sha256:known", m.Files[0].Fingerprint)
+		assert.Equal(t, "sha256:known", m.Files[1].Fingerprint)
+	}
+}
+
+func TestExpandPatterns(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+
+	b := write("b.go", "package todos\n")
+	a := write("a.go", "package todos\n")
+	write("a_test.go", "package todos\n")
+	gen := write("a_goji.go", "// Code generated by sleepywolf; DO NOT EDIT.\n\npackage todos\n")
+
+	paths, err := ExpandPatterns([]string{filepath.Join(dir, "*.go"), b})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{a, b}, paths)
+
+	// Files that are given by name are always included.
+	missing := filepath.Join(dir, "missing.go")
+	paths, err = ExpandPatterns([]string{gen, missing})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{gen, missing}, paths)
+}
+
+func TestRouteTable(t *testing.T) {
+	m := testModel(t, common.Options{Outputs: []string{common.RoutesOutput, common.BatchOutput}})
+	f := m.Files[0]
+	f.ImportPath = "example.com/todos"
+	f.Structs[0].BeforeOne = &common.FuncInfo{Name: "BeforeOne", Params: 2}
+	f.Structs[0].CORS = true
+	f.Positions = map[string]token.Position{
+		"TodoItemsResource":        {Filename: "todos.go", Line: 3, Column: 6},
+		"TodoItemsResource.GetOne": {Filename: "todos.go", Line: 9, Column: 30},
+	}
+
+	// The batch endpoint is only listed once for the package.
+	m.Files = append(m.Files, &File{Path: "more.go", PackageName: "todos", ImportPath: f.ImportPath})
+
+	routes, err := RouteTable(m)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	getMany := Route{
+		Method:   "GET",
+		Path:     "/api/todoitems",
+		Resource: "TodoItemsResource",
+		Handler:  "GetMany",
+		Hooks:    []string{},
+		Source:   "todos.go:3:6",
+	}
+	getOne := Route{
+		Method:   "GET",
+		Path:     "/api/todoitems/:id",
+		Resource: "TodoItemsResource",
+		Handler:  "GetOne",
+		Hooks:    []string{"BeforeOne"},
+		Source:   "todos.go:9:30",
+	}
+	generated := func(method, path, handler string) Route {
+		return Route{
+			Method:   method,
+			Path:     path,
+			Resource: "TodoItemsResource",
+			Handler:  handler,
+			Hooks:    []string{},
+			Source:   "todos.go:3:6",
+		}
+	}
+	headMany, headOne := getMany, getOne
+	headMany.Method, headOne.Method = "HEAD", "HEAD"
+
+	assert.Equal(t, []Route{
+		getMany,
+		headMany,
+		generated("OPTIONS", "/api/todoitems", "cors.Preflight"),
+		generated("DELETE", "/api/todoitems", "notAllowed"),
+		generated("PATCH", "/api/todoitems", "notAllowed"),
+		generated("POST", "/api/todoitems", "notAllowed"),
+		generated("PUT", "/api/todoitems", "notAllowed"),
+		getOne,
+		headOne,
+		generated("OPTIONS", "/api/todoitems/:id", "cors.Preflight"),
+		generated("DELETE", "/api/todoitems/:id", "notAllowed"),
+		generated("PATCH", "/api/todoitems/:id", "notAllowed"),
+		generated("POST", "/api/todoitems/:id", "notAllowed"),
+		generated("PUT", "/api/todoitems/:id", "notAllowed"),
+		{
+			Method:  "POST",
+			Path:    "/api/batch",
+			Handler: "rest.BatchHandler",
+			Hooks:   []string{},
+			Source:  "todos.go",
+		},
+	}, routes)
+}
@@ -0,0 +1,205 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// Goji is the backend that generates code for the goji router, using the
+// built-in templates along with any that are given by the Templates option.
+var Goji Backend = gojiBackend{}
+
+type gojiBackend struct{}
+
+func (gojiBackend) Generate(m *Model) (map[string][]byte, error) {
+	h := &helpers{m.Options.Options, m.Verbs}
+
+	tmpl, err := h.finalTemplates(m.Options.Templates)
+	if err != nil {
+		return nil, &Error{OpTemplate, m.Options.Templates, err}
+	}
+
+	ret := map[string][]byte{}
+	for _, f := range m.Files {
+		data := TemplateData{
+			Version:     Version,
+			Summary:     m.Options.Summary(),
+			Fingerprint: f.Fingerprint,
+			PackageName: f.PackageName,
+			Structs:     f.Structs,
+			UrlPrefix:   m.Options.Prefix,
+			Imports:     defaultImports,
+			Routes:      m.Options.HasOutput(common.RoutesOutput),
+			Batch:       m.Options.HasOutput(common.BatchOutput),
+			Verbs:       m.Verbs,
+		}
+
+		finalBuff := bytes.Buffer{}
+		if err := tmpl.Execute(&finalBuff, data); err != nil {
+			return nil, &Error{OpTemplate, f.Path, err}
+		}
+
+		out, err := common.FormatSource(finalBuff.Bytes())
+		if syntaxErr, ok := err.(*common.SyntaxError); ok {
+			offset := syntaxErr.Offset(finalBuff.Bytes())
+			syntaxErr.Template = locateTemplate(tmpl, data, offset)
+		}
+		if err != nil {
+			return nil, &Error{OpFormat, f.Output(), err}
+		}
+		ret[f.Output()] = out
+	}
+	return ret, nil
+}
+
+// The markers that locateTemplate puts around the output of each template.
+// They're control characters, which never appear in generated code.
+const (
+	templateBegin = "\x01"
+	templateName  = "\x02"
+	templateEnd   = "\x03"
+)
+
+// Returns the name of the template that generated the text at the given
+// offset in the output of executing tmpl with data, or an empty string if it
+// can't be found.
+//
+// This executes a copy of the templates in which each one is wrapped with
+// markers, and then finds the innermost template around the offset while
+// skipping over the markers.
+func locateTemplate(tmpl *template.Template, data interface{}, offset int) string {
+	marked, err := tmpl.Clone()
+	if err != nil {
+		return ""
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+
+		body := t.Name() + " (body)"
+		wrapper, err := template.New(t.Name()).Parse(templateBegin + t.Name() + templateName +
+			"{{template " + strconv.Quote(body) + " .}}" + templateEnd)
+		if err != nil {
+			return ""
+		}
+
+		if _, err := marked.AddParseTree(body, t.Tree); err != nil {
+			return ""
+		}
+		if _, err := marked.AddParseTree(t.Name(), wrapper.Tree); err != nil {
+			return ""
+		}
+	}
+
+	buf := bytes.Buffer{}
+	if err := marked.ExecuteTemplate(&buf, tmpl.Name(), data); err != nil {
+		return ""
+	}
+
+	// Parse errors are often reported at the whitespace after the mistake,
+	// e.g. a missing parenthesis at the end of a line, so this finds the
+	// template that generated the last non-space character up to the offset.
+	out := buf.String()
+	stack := []string{}
+	found := ""
+	pos := 0
+	for i := 0; i < len(out) && pos <= offset; i++ {
+		switch out[i : i+1] {
+		case templateBegin:
+			end := strings.Index(out[i:], templateName)
+			if end < 0 {
+				return ""
+			}
+			stack = append(stack, out[i+1:i+end])
+			i += end
+			continue
+		case templateEnd:
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		if len(stack) > 0 && !unicode.IsSpace(rune(out[i])) {
+			found = stack[len(stack)-1]
+		}
+		pos++
+	}
+	return found
+}
+
+// Returns the functions that are available to the final template.
+func (h *helpers) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"RegisterFuncFor": h.RegisterFuncFor,
+		"UrlFor":          h.UrlFor,
+		"HasBeforeType":   h.HasBeforeType,
+		"PathFor":         h.PathFor,
+		"PatternFor":      h.PatternFor,
+		"PathsFor":        h.PathsFor,
+		"ResourceFor":     ResourceFor,
+		"HandlerFor":      HandlerFor,
+		"HasTypedHandler": HasTypedHandler,
+		"HasConditions":   HasConditions,
+		"HasETagResponse": HasETagResponse,
+		"VerbFor":         h.VerbFor,
+	}
+}
+
+// Returns the final template, with any named templates that are defined by
+// the .tmpl files in the given directory replacing the built-in ones.
+func (h *helpers) finalTemplates(dir string) (*template.Template, error) {
+	tmpl := template.Must(template.New("final").
+		Funcs(h.funcMap()).
+		Parse(finalTemplate))
+
+	if dir == "" {
+		return tmpl, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .tmpl files in %s", dir)
+	}
+
+	// Files are parsed in order, so later files override earlier ones.
+	sort.Strings(files)
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// Anything outside of a {{define}} would replace the whole output,
+		// so files may only define named templates.
+		t, err := template.New(filepath.Base(file)).Funcs(h.funcMap()).Parse(string(contents))
+		if err != nil {
+			return nil, err
+		}
+		if t.Tree != nil && strings.TrimSpace(t.Tree.Root.String()) != "" {
+			return nil, fmt.Errorf("%s: text outside of a {{define}}", file)
+		}
+
+		for _, def := range t.Templates() {
+			if def.Name() == t.Name() {
+				continue
+			}
+			if _, err := tmpl.AddParseTree(def.Name(), def.Tree); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,101 @@
+package generator
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+)
+
+// Returns (packageName, []structs, error), with the structs in the order that
+// they're declared in.
+func GetFileInfo(inputPath string) (string, []string, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, inputPath, nil, 0)
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	packageName := f.Name.String()
+	structs := []string{}
+
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				return "", nil, fmt.Errorf("Unknown type without TypeSpec: %v", spec)
+			}
+
+			_, ok = ts.Type.(*ast.StructType)
+			if !ok {
+				// Not a struct, so skip it
+				continue
+			}
+
+			structs = append(structs, ts.Name.Name)
+		}
+	}
+
+	return packageName, structs, nil
+}
+
+// Returns the doc comments and the positions of the types and methods in the
+// given file, keyed by the type's name or by "Type.Method" for methods.
+func GetFileDocs(inputPath string) (map[string]string, map[string]token.Position, error) {
+	fset := token.NewFileSet()
+
+	f, err := parser.ParseFile(fset, inputPath, nil, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	docs := map[string]string{}
+	positions := map[string]token.Position{}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				positions[ts.Name.Name] = fset.Position(ts.Name.Pos())
+
+				// A lone type declaration has its comment on the GenDecl.
+				doc := ts.Doc
+				if doc == nil && len(d.Specs) == 1 {
+					doc = d.Doc
+				}
+				if doc != nil {
+					docs[ts.Name.Name] = doc.Text()
+				}
+			}
+
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) != 1 {
+				continue
+			}
+
+			recv := d.Recv.List[0].Type
+			if star, ok := recv.(*ast.StarExpr); ok {
+				recv = star.X
+			}
+			if ident, ok := recv.(*ast.Ident); ok {
+				name := ident.Name + "." + d.Name.Name
+				positions[name] = fset.Position(d.Name.Pos())
+				if d.Doc != nil {
+					docs[name] = d.Doc.Text()
+				}
+			}
+		}
+	}
+
+	return docs, positions, nil
+}
@@ -0,0 +1,145 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// The prefix of the executables that implement plugins, so the plugin "foo"
+// is run as "sleepywolf-gen-foo".
+const pluginPrefix = "sleepywolf-gen-"
+
+// Plugin is a backend that runs the executable that implements the plugin
+// with the given name, and returns the files that it generates.  Their paths
+// are relative to the directory of the first input file.
+type Plugin struct {
+	// Name of the plugin, so "foo" runs "sleepywolf-gen-foo"
+	Name string
+
+	// The options that are passed to the plugin
+	Options string
+}
+
+func (p Plugin) Generate(m *Model) (map[string][]byte, error) {
+	h := &helpers{m.Options.Options, m.Verbs}
+
+	pkgs := []common.PackageModel{}
+	for _, f := range m.Files {
+		pkg, err := h.packageModel(f)
+		if err != nil {
+			return nil, &Error{OpPlugin, p.Name, err}
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	files, err := runPlugin(p.Name, p.Options, pkgs)
+	if err != nil {
+		return nil, &Error{OpPlugin, p.Name, err}
+	}
+
+	dir := "."
+	if len(m.Files) > 0 {
+		dir = filepath.Dir(m.Files[0].Path)
+	}
+
+	ret := map[string][]byte{}
+	for _, f := range files {
+		ret[filepath.Join(dir, filepath.FromSlash(f.Name))] = []byte(f.Content)
+	}
+	return ret, nil
+}
+
+// Builds the model of the given file that is sent to plugins.
+func (h *helpers) packageModel(f *File) (common.PackageModel, error) {
+	pkg := common.PackageModel{
+		Name:       f.PackageName,
+		ImportPath: f.ImportPath,
+		File:       filepath.ToSlash(f.Path),
+		Resources:  []common.ResourceModel{},
+	}
+
+	for _, s := range f.Structs {
+		res := common.ResourceModel{
+			StructInfo:  s,
+			Doc:         f.Docs[s.StructName],
+			HandlerDocs: map[string]string{},
+			Routes:      []common.RouteModel{},
+		}
+
+		for _, handler := range s.Handlers {
+			if doc, ok := f.Docs[s.StructName+"."+handler.Name]; ok {
+				res.HandlerDocs[handler.Name] = doc
+			}
+
+			verb, err := h.VerbFor(handler.Name)
+			if err != nil {
+				return common.PackageModel{}, err
+			}
+			path, err := h.PathFor(h.opts.Prefix, s, handler.Name)
+			if err != nil {
+				return common.PackageModel{}, err
+			}
+			res.Routes = append(res.Routes, common.RouteModel{
+				Method:  verb.Method,
+				Path:    path,
+				Handler: handler.Name,
+			})
+		}
+
+		pkg.Resources = append(pkg.Resources, res)
+	}
+	return pkg, nil
+}
+
+// Runs the plugin with the given name, and returns the files that it
+// generated.  The plugin's stderr is passed through so that it can report
+// what it's doing.
+func runPlugin(name, opts string, pkgs []common.PackageModel) ([]common.PluginFile, error) {
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := json.Marshal(common.PluginRequest{
+		Version:  common.ModelVersion,
+		Options:  opts,
+		Packages: pkgs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stdout := bytes.Buffer{}
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(req)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	resp := common.PluginResponse{}
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("couldn't decode response: %s", err)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	for _, f := range resp.Files {
+		clean := filepath.Clean(filepath.FromSlash(f.Name))
+		if f.Name == "" || filepath.IsAbs(clean) || clean == ".." ||
+			strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid file name %q", f.Name)
+		}
+	}
+	return resp.Files, nil
+}
@@ -0,0 +1,310 @@
+package generator
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// The options and verbs that the helper functions for the templates use.
+type helpers struct {
+	opts  common.Options
+	verbs common.Verbs
+}
+
+// Get the name of the function to call to register the given handler
+func (h *helpers) RegisterFuncFor(funcName string) (string, error) {
+	verb, err := h.VerbFor(funcName)
+	if err != nil {
+		return "", err
+	}
+
+	// Goji's registration functions are the title-cased HTTP methods.
+	return verb.Method[:1] + strings.ToLower(verb.Method[1:]), nil
+}
+
+// Helper function to generate a URL for a given resource / function pair.  The
+// resource's part of the URL comes from Options.ResourcePath.
+func (h *helpers) UrlFor(structName, funcName string) (string, error) {
+	verb, err := h.VerbFor(funcName)
+	if err != nil {
+		return "", err
+	}
+
+	url := h.opts.ResourcePath(structName)
+	if verb.Path == common.ItemPath {
+		url += "/:id"
+	}
+	if verb.Suffix != "" {
+		url += "/" + verb.Suffix
+	}
+	return url, nil
+}
+
+// Helper function that, given the name of a "Before" function and a handler name,
+// returns whether or not the handler should execute the Before function.
+func (h *helpers) HasBeforeType(funcName, beforeType string) (bool, error) {
+	if beforeType == "BeforeAll" {
+		return true, nil
+	}
+
+	verb, err := h.VerbFor(funcName)
+	if err != nil {
+		return false, err
+	}
+
+	return verb.Hook == beforeType, nil
+}
+
+// Helper function that returns the verb for the given handler.
+func (h *helpers) VerbFor(funcName string) (common.Verb, error) {
+	verb, ok := h.verbs.Lookup(funcName)
+	if !ok {
+		return common.Verb{}, fmt.Errorf("unknown function name: %s", funcName)
+	}
+	return verb, nil
+}
+
+// Helper function that returns the path that the given handler is registered
+// at, like "/api/foo/:id".  Resources that have their own prefix in the
+// configuration file use it instead of the given one, and singleton resources
+// have no ":id", so all of their handlers are registered at the resource's
+// path.
+func (h *helpers) PathFor(prefix string, s common.StructInfo, funcName string) (string, error) {
+	url, err := h.UrlFor(s.StructName, funcName)
+	if err != nil {
+		return "", err
+	}
+
+	if p := h.opts.Resources[s.StructName].Prefix; p != "" {
+		prefix = p
+	}
+
+	path := prefix + "/" + url
+	if s.Singleton {
+		path = strings.Replace(path, "/:id", "", 1)
+	}
+	return path, nil
+}
+
+// Helper function that returns the Go expression for the pattern that the given
+// handler is registered under, at the path given by PathFor.  Routes with an
+// ":id" on resources that declare an ID type are registered as a regular
+// expression, so that requests with IDs of the wrong type never reach the
+// handler.
+func (h *helpers) PatternFor(prefix string, s common.StructInfo, funcName string) (string, error) {
+	path, err := h.PathFor(prefix, s, funcName)
+	if err != nil {
+		return "", err
+	}
+
+	if s.IDType == "" || !strings.Contains(path+"/", "/:id/") {
+		return strconv.Quote(path), nil
+	}
+
+	idPattern, err := common.IDPattern(s.IDType)
+	if err != nil {
+		return "", err
+	}
+
+	parts := strings.SplitN(path+"/", "/:id/", 2)
+	re := "^" + regexp.QuoteMeta(parts[0]+"/") + "(?P<id>" + idPattern + ")" +
+		regexp.QuoteMeta(strings.TrimSuffix("/"+parts[1], "/")) + "$"
+	return fmt.Sprintf("regexp.MustCompile(%s)", strconv.Quote(re)), nil
+}
+
+// Information about a single path that a resource's handlers are registered
+// under.
+type RoutePath struct {
+	// Go expression for the pattern of this path
+	Pattern string
+
+	// Value of the "Allow" header for this path
+	Allow string
+
+	// The handlers registered under this path
+	Handlers []common.FuncInfo
+
+	// Goji's registration functions for the common methods that this path
+	// doesn't handle, e.g. "Delete", which respond with a 405
+	Disallowed []string
+}
+
+// The methods that paths respond to with a 405 if they don't handle them.
+// Goji routes HEAD requests to GET handlers, so HEAD isn't needed.
+var disallowableMethods = []string{"DELETE", "GET", "PATCH", "POST", "PUT"}
+
+// Removes adjacent duplicates from a sorted list.
+func dedupe(list []string) []string {
+	ret := []string{}
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// Helper function that groups a resource's handlers by the path that they're
+// registered under, in the order that each path is first used.  Every path
+// answers OPTIONS, GET handlers also answer HEAD requests, and the common
+// methods that a path doesn't handle are listed in Disallowed.
+//
+// Since Goji uses the first route that matches, paths with a suffix are
+// registered before the others (so "/foo/search" isn't mistaken for
+// "/foo/:id"), and HEAD handlers come before GET handlers on the same path.
+func (h *helpers) PathsFor(prefix string, s common.StructInfo) ([]RoutePath, error) {
+	paths := []RoutePath{}
+	methods := [][]string{}
+	index := map[string]int{}
+
+	handlers := append([]common.FuncInfo{}, s.Handlers...)
+	sort.SliceStable(handlers, func(i, j int) bool {
+		vi, _ := h.VerbFor(handlers[i].Name)
+		vj, _ := h.VerbFor(handlers[j].Name)
+		if (vi.Suffix != "") != (vj.Suffix != "") {
+			return vi.Suffix != ""
+		}
+		return vi.Method == "HEAD" && vj.Method != "HEAD"
+	})
+
+	for _, f := range handlers {
+		pattern, err := h.PatternFor(prefix, s, f.Name)
+		if err != nil {
+			return nil, err
+		}
+		method, err := h.RegisterFuncFor(f.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		i, ok := index[pattern]
+		if !ok {
+			i = len(paths)
+			index[pattern] = i
+			paths = append(paths, RoutePath{Pattern: pattern})
+			methods = append(methods, []string{"OPTIONS"})
+		}
+
+		paths[i].Handlers = append(paths[i].Handlers, f)
+		methods[i] = append(methods[i], strings.ToUpper(method))
+		if method == "Get" {
+			methods[i] = append(methods[i], "HEAD")
+		}
+	}
+
+	for i := range paths {
+		sort.Strings(methods[i])
+		methods[i] = dedupe(methods[i])
+		paths[i].Allow = strings.Join(methods[i], ", ")
+
+		for _, method := range disallowableMethods {
+			j := sort.SearchStrings(methods[i], method)
+			if j == len(methods[i]) || methods[i][j] != method {
+				paths[i].Disallowed = append(paths[i].Disallowed, method[:1]+strings.ToLower(method[1:]))
+			}
+		}
+	}
+	return paths, nil
+}
+
+// The data passed to the final template.  Templates in the Templates
+// directory see the same data, and may use any of the functions in funcMap.
+type TemplateData struct {
+	// Version of sleepywolf
+	Version string
+
+	// Summary of the options that the code was generated with
+	Summary string
+
+	// Hash of the inputs that the code was generated from
+	Fingerprint string
+
+	// Name of the package that the generated code is in
+	PackageName string
+
+	// The resources to generate code for
+	Structs []common.StructInfo
+
+	// Prefix for generated URLs, e.g. "/api"
+	UrlPrefix string
+
+	// The packages that may be imported, other than net/http and Goji.
+	// Imports that aren't used are removed.
+	Imports []string
+
+	// Whether the Register functions are generated
+	Routes bool
+
+	// Whether the RegisterBatch function is generated
+	Batch bool
+
+	// The verbs that are recognized
+	Verbs common.Verbs
+}
+
+// The data passed to the "Register" template, which is a struct along with
+// the URL prefix.
+type ResourceData struct {
+	common.StructInfo
+	Prefix string
+}
+
+// Helper function that combines the URL prefix and a struct.
+func ResourceFor(prefix string, s common.StructInfo) ResourceData {
+	return ResourceData{s, prefix}
+}
+
+// The data passed to the "Handler", "HandlerCall" and "TypedHandler"
+// templates, which need to know about the struct as well as the handler.
+type HandlerData struct {
+	common.FuncInfo
+	Struct common.StructInfo
+}
+
+// Helper function that combines a struct and one of its handlers.
+func HandlerFor(s common.StructInfo, f common.FuncInfo) HandlerData {
+	return HandlerData{f, s}
+}
+
+// Helper function that returns whether the given struct has a typed handler
+// with the given name.
+func HasTypedHandler(s common.StructInfo, funcName string) bool {
+	for _, f := range s.Handlers {
+		if f.Name == funcName && f.Typed {
+			return true
+		}
+	}
+	return false
+}
+
+// Helper function that returns whether the given handler evaluates
+// conditional requests using the resource's ETag method.
+func HasConditions(s common.StructInfo, funcName string) bool {
+	switch funcName {
+	case "GetOne", "Put", "Patch", "DeleteOne":
+		return s.ETag
+	}
+	return false
+}
+
+// Helper function that returns whether the given handler's successful
+// responses carry the resource's ETag, as it is after the handler has run.
+func HasETagResponse(s common.StructInfo, funcName string) bool {
+	switch funcName {
+	case "Put", "Patch":
+		return s.ETag
+	}
+	return false
+}
+
+// The packages, other than net/http and Goji, that the generated code may
+// import.  Any that it doesn't use are removed when it's formatted.
+var defaultImports = []string{
+	"github.com/andrew-d/sleepywolf/rest",
+	"regexp",
+}
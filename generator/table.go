@@ -0,0 +1,180 @@
+package generator
+
+import (
+	"strings"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// Route is a route that the generated code registers.
+type Route struct {
+	// HTTP method, e.g. "GET".  GET routes also answer HEAD requests.
+	Method string
+
+	// Full path, including the prefix, e.g. "/api/todos/:id"
+	Path string
+
+	// Name of the resource's struct, or empty for the batch endpoint
+	Resource string
+
+	// Name of the handler, e.g. "GetOne"
+	Handler string
+
+	// The Before functions that run before the handler, in order
+	Hooks []string
+
+	// Position of the handler in the input file, or of the resource if the
+	// handler isn't declared there (e.g. because it's promoted from an
+	// embedded struct), like "todos.go:42:25"
+	Source string
+}
+
+// RouteTable returns the routes that the generated code for the model
+// registers, in the order of the input files and their resources.  Each
+// resource's routes are in the order that they're registered: the handlers
+// under each path (GET handlers are followed by a HEAD route, since Goji
+// routes HEAD requests to them), then the path's OPTIONS route and the
+// methods that it responds to with a 405.  The batch endpoint is listed once
+// for each package.
+func RouteTable(m *Model) ([]Route, error) {
+	h := &helpers{m.Options.Options, m.Verbs}
+
+	routes := []Route{}
+	batched := map[string]bool{}
+	for _, f := range m.Files {
+		if h.opts.HasOutput(common.RoutesOutput) {
+			for _, s := range f.Structs {
+				structRoutes, err := h.routes(f, s)
+				if err != nil {
+					return nil, &Error{OpTemplate, f.Path, err}
+				}
+				routes = append(routes, structRoutes...)
+			}
+		}
+
+		if h.opts.HasOutput(common.BatchOutput) && !batched[f.ImportPath] {
+			batched[f.ImportPath] = true
+			routes = append(routes, Route{
+				Method:  "POST",
+				Path:    h.opts.Prefix + "/batch",
+				Handler: "rest.BatchHandler",
+				Hooks:   []string{},
+				Source:  f.Path,
+			})
+		}
+	}
+	return routes, nil
+}
+
+// Returns the routes for a resource.  The routes that the generated code
+// answers itself, rather than with one of the resource's handlers, have the
+// name of what answers them as their handler: "options" or, for resources
+// with CORS, "cors.Preflight" for OPTIONS, and "notAllowed" for a 405.
+func (h *helpers) routes(f *File, s common.StructInfo) ([]Route, error) {
+	paths, err := h.PathsFor(h.opts.Prefix, s)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := []Route{}
+	for _, p := range paths {
+		// PathsFor puts HEAD handlers before GET handlers, and they answer
+		// HEAD requests instead.
+		head := false
+		for _, handler := range p.Handlers {
+			route, err := h.route(f, s, handler.Name)
+			if err != nil {
+				return nil, err
+			}
+			routes = append(routes, route)
+			head = head || route.Method == "HEAD"
+
+			if route.Method == "GET" && !head {
+				route.Method = "HEAD"
+				routes = append(routes, route)
+			}
+		}
+
+		path, err := h.PathFor(h.opts.Prefix, s, p.Handlers[0].Name)
+		if err != nil {
+			return nil, err
+		}
+		generated := Route{
+			Method:   "OPTIONS",
+			Path:     path,
+			Resource: s.StructName,
+			Handler:  "options",
+			Hooks:    []string{},
+			Source:   f.source(s.StructName),
+		}
+		if s.CORS {
+			generated.Handler = "cors.Preflight"
+		}
+		routes = append(routes, generated)
+
+		generated.Handler = "notAllowed"
+		for _, method := range p.Disallowed {
+			generated.Method = strings.ToUpper(method)
+			routes = append(routes, generated)
+		}
+	}
+	return routes, nil
+}
+
+// Returns the route for one of a resource's handlers.
+func (h *helpers) route(f *File, s common.StructInfo, funcName string) (Route, error) {
+	verb, err := h.VerbFor(funcName)
+	if err != nil {
+		return Route{}, err
+	}
+	path, err := h.PathFor(h.opts.Prefix, s, funcName)
+	if err != nil {
+		return Route{}, err
+	}
+
+	// The generated code only calls the Before functions that the resource
+	// has, in the same way as the Handler template.
+	hooks := []string{}
+	for _, hook := range []struct {
+		name string
+		fn   *common.FuncInfo
+	}{
+		{"BeforeAll", s.BeforeAll},
+		{"BeforeOne", s.BeforeOne},
+		{"BeforeMany", s.BeforeMany},
+	} {
+		ok, err := h.HasBeforeType(funcName, hook.name)
+		if err != nil {
+			return Route{}, err
+		}
+		if ok && hook.fn != nil {
+			hooks = append(hooks, hook.name)
+		}
+	}
+
+	// Handlers that aren't declared in the file (e.g. because they're
+	// promoted from an embedded struct) are at the resource's position.
+	source := f.source(s.StructName)
+	if _, ok := f.Positions[s.StructName+"."+funcName]; ok {
+		source = f.source(s.StructName + "." + funcName)
+	}
+
+	return Route{
+		Method:   strings.ToUpper(verb.Method),
+		Path:     path,
+		Resource: s.StructName,
+		Handler:  funcName,
+		Hooks:    hooks,
+		Source:   source,
+	}, nil
+}
+
+// Returns the position of the type or method with the given name in the
+// file, keyed in the same way as Positions, or the file's path if it isn't
+// known.
+func (f *File) source(name string) string {
+	if pos := f.Positions[name]; pos.IsValid() {
+		return pos.String()
+	}
+	return f.Path
+}
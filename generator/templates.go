@@ -0,0 +1,260 @@
+package generator
+
+const gatherTemplate = `
+// DO NOT EDIT!!!
+// This code was generated by github.com/andrew-d/sleepywolf
+
+package main
+
+import (
+	"os"
+
+	"github.com/andrew-d/sleepywolf/common"
+	"github.com/andrew-d/sleepywolf/gather"
+
+	// These are the packages we're introspecting
+{{range .Targets}}
+	{{.Alias}} "{{.ImportPath}}"
+{{end}}
+)
+
+func main() {
+	g := gather.NewInfoGatherer()
+	g.Verbs = {{printf "%#v" .Verbs}}
+{{range .Structs}}
+	g.Register("{{.Name}}", &{{.Alias}}.{{.Name}}{})
+{{end}}
+	g.Run(os.Stdout)
+}
+`
+
+// The template for the generated code.  Each part of the output is a named
+// template, so that they can be overridden individually by the Templates
+// option.
+const finalTemplate = `
+{{define "Header"}}
+// Code generated by sleepywolf; DO NOT EDIT.
+// Version: {{.Version}}
+// Options: {{.Summary}}
+// Input: {{.Fingerprint}}
+
+package {{.PackageName}}
+
+import (
+	"net/http"
+	{{range .Imports}}"{{.}}"
+	{{end}}
+
+	"github.com/zenazn/goji/web"
+)
+{{end}}
+
+{{define "BeforeFunc"}}
+	{{with .}}
+		{{if .Params | eq 3}}
+		if !res.{{.Name}}(c, w, r) { return }
+		{{else}}
+		if !res.{{.Name}}(w, r) { return }
+		{{end}}
+	{{end}}
+{{end}}
+
+{{define "HandlerCall"}}
+	{{if .Typed}}
+		{{template "TypedHandler" .}}
+	{{else if .Params | eq 3}}
+		res.{{.Name}}(c, w, r)
+	{{else}}
+		res.{{.Name}}(w, r)
+	{{end}}
+{{end}}
+
+{{define "TypedHandler"}}
+	{{if eq .Name "GetMany"}}
+		page, err := rest.ParsePageRequest(r.URL.Query(), paging)
+		if err != nil {
+			rest.WriteError(c, w, err)
+			return
+		}
+		result, err := res.GetMany(rest.NewContext(c, r), page)
+		if err != nil {
+			rest.WriteError(c, w, err)
+			return
+		}
+		rest.WritePage(c, w, r, page, result, paging)
+	{{else if eq .Name "GetOne"}}
+		result, err := res.GetOne(rest.NewContext(c, r))
+		if err != nil {
+			rest.WriteError(c, w, err)
+			return
+		}
+		{{if not .Struct.ETag}}
+			if v, ok := result.(rest.Versioned); ok && !rest.CheckConditions(w, r, v.ETag()) {
+				return
+			}
+		{{end}}
+		rest.WriteResult(c, w, {{(VerbFor .Name).Status}}, result)
+	{{else if eq .Name "Patch"}}
+		patch, err := rest.ReadPatch(r)
+		if err != nil {
+			rest.WriteError(c, w, err)
+			return
+		}
+		ctx := rest.NewContext(c, r)
+
+		{{if HasTypedHandler .Struct "GetOne"}}
+			// Apply the patch to the current object.
+			current, err := res.GetOne(ctx)
+			if err != nil {
+				rest.WriteError(c, w, err)
+				return
+			}
+			{{if not .Struct.ETag}}
+				if v, ok := current.(rest.Versioned); ok && !rest.CheckConditions(w, r, v.ETag()) {
+					return
+				}
+			{{end}}
+			if err := patch.ApplyTo(current); err != nil {
+				rest.WriteError(c, w, err)
+				return
+			}
+		{{end}}
+
+		result, err := res.Patch(ctx, patch)
+		if err != nil {
+			rest.WriteError(c, w, err)
+			return
+		}
+		rest.WriteResult(c, w, {{(VerbFor .Name).Status}}, result)
+	{{end}}
+{{end}}
+
+{{define "Register"}}
+{{$struct := .StructInfo}}
+{{$prefix := .Prefix}}
+// Register{{.StructName}} registers the handlers of {{.StructName}} with mux.
+// Each of its paths also answers OPTIONS, and the common methods that it
+// doesn't handle with a 405.  Since Goji uses the first route that matches,
+// any other routes for those methods on a path that one of these patterns
+// matches must be added to mux before this is called, or they're never
+// reached.
+func Register{{.StructName}}(mux *web.Mux) {
+	{{if .CORS}}
+		cors := (&{{.StructName}}{}).CORS()
+	{{end}}
+	{{if .MediaTypes}}
+		codecs := (&{{.StructName}}{}).Codecs()
+	{{end}}
+	{{if .Idempotent}}
+		idempotency := (&{{.StructName}}{}).IdempotencyStore()
+	{{end}}
+	{{with .Pagination}}
+		paging := rest.PageOptions{
+			DefaultLimit: {{.DefaultLimit}},
+			MaxLimit:     {{.MaxLimit}},
+			Envelope:     {{.Envelope}},
+		}
+	{{end}}
+
+	{{range $i, $path := PathsFor $prefix $struct}}
+		pattern{{$i}} := {{$path.Pattern}}
+
+		{{range $path.Handlers}}
+			handlerFor{{.Name}} := func(c web.C, w http.ResponseWriter, r *http.Request) {
+				{{template "Handler" HandlerFor $struct .}}
+			}
+			{{if eq (VerbFor .Name).Method "GET"}}// Note: Goji also routes HEAD requests to GET handlers.
+			{{end}}mux.{{RegisterFuncFor .Name}}(pattern{{$i}}, handlerFor{{.Name}})
+		{{end}}
+
+		mux.Options(pattern{{$i}}, func(w http.ResponseWriter, r *http.Request) {
+			{{if $struct.CORS}}
+				if cors.Preflight(w, r, "{{$path.Allow}}") {
+					return
+				}
+			{{end}}
+			w.Header().Set("Allow", "{{$path.Allow}}")
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		{{if $path.Disallowed}}
+			// The common methods that this path doesn't handle aren't
+			// allowed.  Only those methods are registered, but routes for
+			// them on a matching path that are added to the mux later are
+			// never reached (see above).
+			notAllowed{{$i}} := func(w http.ResponseWriter, r *http.Request) {
+				{{if $struct.CORS}}cors.SetHeaders(w, r){{end}}
+				w.Header().Set("Allow", "{{$path.Allow}}")
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			}
+			{{range $path.Disallowed}}mux.{{.}}(pattern{{$i}}, notAllowed{{$i}})
+			{{end}}
+		{{end}}
+	{{end}}
+}
+{{end}}
+
+{{define "Handler"}}{{$struct := .Struct}}{{if $struct.CORS}}cors.SetHeaders(w, r){{end}}
+	{{if $struct.MediaTypes}}
+		if !rest.Negotiate(codecs, &c, w, r) {
+			return
+		}
+	{{end}}
+
+	// Create a new instance of the struct.
+	res := &{{$struct.StructName}}{}
+
+	{{if HasBeforeType .Name "BeforeAll"}}{{template "BeforeFunc" $struct.BeforeAll}}{{end}}
+	{{if HasBeforeType .Name "BeforeOne"}}{{template "BeforeFunc" $struct.BeforeOne}}{{end}}
+	{{if HasBeforeType .Name "BeforeMany"}}{{template "BeforeFunc" $struct.BeforeMany}}{{end}}
+
+	{{if HasConditions $struct .Name}}
+		if !rest.CheckConditions(w, r, res.ETag()) {
+			return
+		}
+	{{end}}
+	{{if HasETagResponse $struct .Name}}
+		w = rest.ETagWriter(w, res)
+	{{end}}
+
+	{{if and $struct.Filter (eq .Name "GetMany")}}
+		{{if $struct.Pagination}}
+			err := rest.DecodeQuery(r.URL.Query(), res.Filter(), "limit", "offset", "cursor")
+		{{else}}
+			err := rest.DecodeQuery(r.URL.Query(), res.Filter())
+		{{end}}
+		if err != nil {
+			rest.WriteError(c, w, err)
+			return
+		}
+	{{end}}
+
+	{{if and $struct.Idempotent (eq .Name "Post")}}
+		rest.Idempotent(idempotency, w, r, func(w http.ResponseWriter) {
+			{{template "HandlerCall" .}}
+		})
+	{{else}}
+		{{template "HandlerCall" .}}
+	{{end}}
+{{end}}
+
+{{define "Batch"}}
+// RegisterBatch registers an endpoint at "{{.UrlPrefix}}/batch" that accepts a
+// list of requests and dispatches each of them to mux.
+func RegisterBatch(mux *web.Mux) {
+	mux.Post("{{.UrlPrefix}}/batch", rest.BatchHandler(mux, "{{.UrlPrefix}}/batch"))
+}
+{{end}}
+
+{{template "Header" .}}
+
+{{if .Routes}}
+	{{range .Structs}}
+		{{template "Register" ResourceFor $.UrlPrefix .}}
+	{{end}}
+{{end}}
+
+{{if .Batch}}
+	{{template "Batch" .}}
+{{end}}
+`
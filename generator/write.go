@@ -0,0 +1,154 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/andrew-d/sleepywolf/common"
+)
+
+// ErrNotGenerated is returned by WriteFiles when it would overwrite a Go file
+// that doesn't look like it was generated.
+var ErrNotGenerated = errors.New("file exists and wasn't generated by sleepywolf")
+
+var (
+	// The standard comment that marks generated Go files
+	generatedRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+	// The comment that older versions of sleepywolf put in generated files
+	legacyHeader = "// This code was generated by github.com/andrew-d/sleepywolf"
+)
+
+// IsGenerated returns whether the given Go source has a comment that marks it
+// as generated, before the package clause.
+func IsGenerated(src []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(src))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if generatedRe.MatchString(line) || line == legacyHeader {
+			return true
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "//") {
+			return false
+		}
+	}
+	return false
+}
+
+// A file that's being replaced by WriteFiles.
+type pendingFile struct {
+	path     string
+	tmp      string
+	previous []byte
+	existed  bool
+	mode     os.FileMode
+}
+
+// WriteFiles writes the given files, keyed by path, as a single transaction.
+// Each file is written to a temporary file that's renamed over the original,
+// and if any of them fail, the files that were already replaced are restored.
+//
+// Unless force is set, Go files that already exist must have been generated
+// (see IsGenerated), and nothing is written if any of them weren't.
+func WriteFiles(files map[string][]byte, force bool) error {
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	// Check every file before writing anything.
+	pending := []*pendingFile{}
+	for _, path := range paths {
+		p := &pendingFile{path: path, mode: 0644}
+
+		info, err := os.Stat(path)
+		if err == nil {
+			p.existed = true
+			p.mode = info.Mode().Perm()
+			if p.previous, err = os.ReadFile(path); err != nil {
+				return &Error{OpWrite, path, err}
+			}
+			if !force && strings.HasSuffix(path, ".go") && !IsGenerated(p.previous) {
+				return &Error{OpWrite, path, ErrNotGenerated}
+			}
+		} else if !os.IsNotExist(err) {
+			return &Error{OpWrite, path, err}
+		}
+
+		pending = append(pending, p)
+	}
+
+	// Write all of the temporary files.
+	cleanup := func() {
+		for _, p := range pending {
+			if p.tmp != "" {
+				os.Remove(p.tmp)
+			}
+		}
+	}
+	for _, p := range pending {
+		if err := writeTemp(p, files[p.path]); err != nil {
+			cleanup()
+			return &Error{OpWrite, p.path, err}
+		}
+	}
+
+	// Move them into place, and undo it if that fails part-way through.
+	for i, p := range pending {
+		if err := os.Rename(p.tmp, p.path); err != nil {
+			cleanup()
+			for _, done := range pending[:i] {
+				restore(done)
+			}
+			return &Error{OpWrite, p.path, err}
+		}
+		p.tmp = ""
+	}
+	return nil
+}
+
+// Writes the contents of a file to a temporary file next to it.
+func writeTemp(p *pendingFile, contents []byte) error {
+	dir := filepath.Dir(p.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	f, err := common.TempFileWithSuffix(dir, "."+filepath.Base(p.path), ".tmp")
+	if err != nil {
+		return err
+	}
+	p.tmp = f.Name()
+
+	_, err = f.Write(contents)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(p.tmp, p.mode)
+	}
+	return err
+}
+
+// Puts back the previous contents of a file that was replaced.
+func restore(p *pendingFile) {
+	if !p.existed {
+		os.Remove(p.path)
+		return
+	}
+	if err := writeTemp(p, p.previous); err == nil {
+		os.Rename(p.tmp, p.path)
+	}
+}
@@ -0,0 +1,57 @@
+package generator
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsGenerated(t *testing.T) {
+	assert.True(t, IsGenerated([]byte("// Code generated by sleepywolf; DO NOT EDIT.\n\npackage foo\n")))
+	assert.True(t, IsGenerated([]byte("\n// This code was generated by github.com/andrew-d/sleepywolf\n\npackage foo\n")))
+	assert.False(t, IsGenerated([]byte("package foo\n\n// Code generated by sleepywolf; DO NOT EDIT.\n")))
+	assert.False(t, IsGenerated([]byte("// Package foo does things.\npackage foo\n")))
+}
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	gen := filepath.Join(dir, "a_goji.go")
+	hand := filepath.Join(dir, "b_goji.go")
+	other := filepath.Join(dir, "out", "perms.txt")
+
+	assert.NoError(t, os.WriteFile(gen, []byte("// Code generated by sleepywolf; DO NOT EDIT.\npackage a\n"), 0600))
+	assert.NoError(t, os.WriteFile(hand, []byte("package b\n"), 0644))
+
+	// Nothing is written if any file would overwrite one that wasn't
+	// generated.
+	err := WriteFiles(map[string][]byte{
+		gen:   []byte("new a"),
+		hand:  []byte("new b"),
+		other: []byte("perms"),
+	}, false)
+	assert.True(t, errors.Is(err, ErrNotGenerated))
+	contents, _ := os.ReadFile(gen)
+	assert.Equal(t, "// Code generated by sleepywolf; DO NOT EDIT.\npackage a\n", string(contents))
+	_, err = os.Stat(other)
+	assert.True(t, os.IsNotExist(err))
+
+	err = WriteFiles(map[string][]byte{
+		gen:   []byte("new a"),
+		hand:  []byte("new b"),
+		other: []byte("perms"),
+	}, true)
+	assert.NoError(t, err)
+	for path, expected := range map[string]string{gen: "new a", hand: "new b", other: "perms"} {
+		contents, _ := os.ReadFile(path)
+		assert.Equal(t, expected, string(contents))
+	}
+
+	// The mode of existing files is kept, and no temporary files are left.
+	info, _ := os.Stat(gen)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 3)
+}
@@ -1,273 +1,408 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"runtime"
+	"sort"
 	"strings"
-	"text/template"
+	"time"
 
 	"github.com/andrew-d/sleepywolf/common"
+	"github.com/andrew-d/sleepywolf/generator"
 )
 
 var (
-	extractFnameRe = regexp.MustCompile(`(.*)(\.go)$`)
-
 	verbose       = flag.Bool("v", false, "print information while generating")
 	keepGenerated = flag.Bool("keep", false, "keep the generated temp files")
 	prefix        = flag.String("prefix", "/api", "prefix for generated URLs")
 	writeToStdout = flag.Bool("stdout", false, "write the output to stdout instead of a file")
+	batch         = flag.Bool("batch", false, "generate a RegisterBatch function for a batch endpoint")
+	verbsFile     = flag.String("verbs", "", "JSON file with additional verbs to recognize")
+	configFile    = flag.String("config", "", "configuration file to use instead of searching for one")
+	templatesDir  = flag.String("templates", "", "directory of .tmpl files that override the built-in templates")
+	check         = flag.Bool("check", false, "fail with a diff if the generated files are out of date, without writing them")
+	showDiff      = flag.Bool("diff", false, "print a diff of the changes to the generated files, without writing them")
+	force         = flag.Bool("force", false, "overwrite output files even if they weren't generated")
+	order         = flag.String("order", "source", "order to generate resources in: \"source\" or \"alpha\"")
+	tags          = flag.String("tags", "", "comma-separated build tags to build the gather program with")
+	mod           = flag.String("mod", "", "module download mode to build the gather program with, like go build's -mod")
+	timeout       = flag.Duration("timeout", 2*time.Minute, "how long building and running each gather program can take")
+	cacheDir      = flag.String("cachedir", "", "directory to cache gather programs in (default is in the user's cache directory)")
+	noCache       = flag.Bool("nocache", false, "always build the gather program, rather than using the cache")
+	incremental   = flag.Bool("incremental", false, "skip packages whose generated files record the same inputs")
+	watchFlag     = flag.Bool("watch", false, "keep running, and regenerate the output whenever the input's package changes")
+	jobs          = flag.Int("j", runtime.NumCPU(), "number of packages to generate at once")
+
+	// The plugins given with -plugin, by name
+	plugins = pluginFlags{}
+
+	// The flags that were parsed, which is flag.CommandLine unless a
+	// subcommand has its own
+	flags = flag.CommandLine
 )
 
+func init() {
+	flag.Var(plugins, "plugin", "run the plugin `name=opts` on the gathered resources (may be repeated)")
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, "Usage of %s:\n\n", os.Args[0])
-	fmt.Fprintf(os.Stderr, "\t%s [options] [input_file]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\t%s [options] input_file...\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\t%s routes [options] input_file...\n\n", os.Args[0])
 	fmt.Fprintf(os.Stderr, "%s generates Go code to link up resources with Goji\n\n", os.Args[0])
 	flag.PrintDefaults()
 	os.Exit(1)
 }
 
-// Get the name of the function to call to register the given handler
-func RegisterFuncFor(funcName string) (string, error) {
-	mapping := map[string]string{
-		"DeleteOne":  "Delete",
-		"DeleteMany": "Delete",
-		"GetMany":    "Get",
-		"GetOne":     "Get",
-		"Patch":      "Patch",
-		"Post":       "Post",
-		"Put":        "Put",
-	}
+// The plugins given on the command line, which is a list of "name=opts" or
+// just "name".
+type pluginFlags map[string]string
 
-	s, ok := mapping[funcName]
-	if !ok {
-		return "", fmt.Errorf("unknown function name: %s", funcName)
+func (p pluginFlags) String() string {
+	parts := []string{}
+	for name, opts := range p {
+		parts = append(parts, name+"="+opts)
 	}
-	return s, nil
+	return strings.Join(parts, ",")
 }
 
-// Helper function to generate a URL for a given resource / function pair
-func UrlFor(structName, funcName string) (string, error) {
-	mapping := map[string]string{
-		"DeleteOne":  "%s/:id",
-		"DeleteMany": "%s",
-		"GetMany":    "%s",
-		"GetOne":     "%s/:id",
-		"Patch":      "%s/:id",
-		"Post":       "%s",
-		"Put":        "%s/:id",
+func (p pluginFlags) Set(value string) error {
+	name, opts := value, ""
+	if i := strings.Index(value, "="); i >= 0 {
+		name, opts = value[:i], value[i+1:]
 	}
+	if name == "" {
+		return fmt.Errorf("missing plugin name in %q", value)
+	}
+	p[name] = opts
+	return nil
+}
 
-	format, ok := mapping[funcName]
-	if !ok {
-		return "", fmt.Errorf("unknown function name: %s", funcName)
+// Loads the options for the package in the given directory from the
+// configuration file, if there is one, and then applies the flags that were
+// given on the command line.
+func loadOptions(dir string) (common.Options, error) {
+	options := common.DefaultOptions
+
+	path := *configFile
+	if path == "" {
+		var err error
+		if path, err = common.FindConfig(dir); err != nil {
+			return options, err
+		}
 	}
 
-	// Remove any trailing "Resource" and lower-case
-	structName = strings.TrimSuffix(structName, "Resource")
-	structName = strings.ToLower(structName)
+	if path != "" {
+		config, err := common.LoadConfig(path)
+		if err != nil {
+			return options, err
+		}
+		pkgOptions, err := config.For(dir)
+		if err != nil {
+			return options, err
+		}
+		if options, err = options.Merge(pkgOptions); err != nil {
+			return options, err
+		}
 
-	// TODO: inflect the name of the resource to generate a real url
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "Config File   : %s\n", path)
+		}
+	}
 
-	return fmt.Sprintf(format, strings.ToLower(structName)), nil
-}
+	// Flags override the configuration file, but only if they were given.
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
 
-// Helper function that, given the name of a "Before" function and a handler name,
-// returns whether or not the handler should execute the Before function.
-func HasBeforeType(funcName, beforeType string) (bool, error) {
-	if beforeType == "BeforeAll" {
-		return true, nil
+	if set["templates"] {
+		options.Templates = *templatesDir
 	}
-
-	mapping := map[string]string{
-		"DeleteOne":  "BeforeOne",
-		"DeleteMany": "BeforeMany",
-		"GetMany":    "BeforeMany",
-		"GetOne":     "BeforeOne",
-		"Patch":      "BeforeOne",
-		"Post":       "BeforeMany",
-		"Put":        "BeforeOne",
+	if set["prefix"] {
+		options.Prefix = *prefix
 	}
-
-	f, ok := mapping[funcName]
-	if !ok {
-		return false, fmt.Errorf("unknown function name: %s", funcName)
+	if set["order"] {
+		options.Order = *order
+		if err := options.Validate(); err != nil {
+			return options, err
+		}
+	}
+	if len(plugins) > 0 {
+		var err error
+		if options, err = options.Merge(common.Options{Plugins: plugins}); err != nil {
+			return options, err
+		}
+	}
+	if set["batch"] {
+		outputs := []string{}
+		for _, out := range options.Outputs {
+			if out != common.BatchOutput {
+				outputs = append(outputs, out)
+			}
+		}
+		if *batch {
+			outputs = append(outputs, common.BatchOutput)
+		}
+		options.Outputs = outputs
+	}
+	if *verbsFile != "" {
+		extra, err := common.LoadVerbs(*verbsFile)
+		if err != nil {
+			return options, err
+		}
+		if options, err = options.Merge(common.Options{Verbs: extra}); err != nil {
+			return options, err
+		}
 	}
 
-	return f == beforeType, nil
+	return options, nil
 }
 
-func main() {
-	flag.Parse()
-	args := flag.Args()
+// Prints the information that was gathered about the given structs to w.
+func printStructs(w io.Writer, structInfos []common.StructInfo) {
+	fmt.Fprintf(w, "Valid Structs : %d\n", len(structInfos))
+	for _, s := range structInfos {
+		fmt.Fprintf(w, "  Struct '%s'\n", s.StructName)
 
-	if len(args) != 1 {
-		usage()
-	}
+		fmt.Fprintf(w, "    Handlers   : ")
+		for i, handler := range s.Handlers {
+			if i > 0 {
+				fmt.Fprintf(w, ", ")
+			}
+			fmt.Fprintf(w, "%s/%d", handler.Name, handler.Params)
+			if handler.Typed {
+				fmt.Fprintf(w, " (typed)")
+			}
+		}
+		fmt.Fprintf(w, "\n")
+
+		fmt.Fprintf(w, "    BeforeOne  : %t\n", s.BeforeOne != nil)
+		fmt.Fprintf(w, "    BeforeMany : %t\n", s.BeforeMany != nil)
+		fmt.Fprintf(w, "    BeforeAll  : %t\n", s.BeforeAll != nil)
+		fmt.Fprintf(w, "    Singleton  : %t\n", s.Singleton)
+		fmt.Fprintf(w, "    CORS       : %t\n", s.CORS)
+		fmt.Fprintf(w, "    ETag       : %t\n", s.ETag)
+		fmt.Fprintf(w, "    Idempotent : %t\n", s.Idempotent)
+		if s.Pagination != nil {
+			fmt.Fprintf(w, "    Pagination : limit %d (max %d), envelope %t\n",
+				s.Pagination.DefaultLimit, s.Pagination.MaxLimit, s.Pagination.Envelope)
+		}
+		if s.Filter != nil {
+			fmt.Fprintf(w, "    Filter     : ")
+			for i, f := range s.Filter.Fields {
+				if i > 0 {
+					fmt.Fprintf(w, ", ")
+				}
+				fmt.Fprintf(w, "%s (%s)", f.Name, f.Type)
+			}
+			fmt.Fprintf(w, "\n")
+			if len(s.Filter.Sort) > 0 {
+				fmt.Fprintf(w, "    Sort       : %s\n", strings.Join(s.Filter.Sort, ", "))
+			}
+		}
+		if len(s.MediaTypes) > 0 {
+			fmt.Fprintf(w, "    Media Types: %s\n", strings.Join(s.MediaTypes, ", "))
+		}
+		if s.IDType != "" {
+			fmt.Fprintf(w, "    ID Type    : %s\n", s.IDType)
+		}
 
-	inputPath := filepath.ToSlash(args[0])
-	outputPath := extractFnameRe.ReplaceAllString(args[0], `${1}_goji.go`)
-	if *writeToStdout {
-		fmt.Fprint(os.Stderr, "Output File   : STDOUT\n")
-	} else {
-		fmt.Fprintf(os.Stderr, "Output File   : %s\n", outputPath)
+		if len(s.Warnings) > 0 {
+			fmt.Fprintf(w, "    Warnings   :\n")
+			for _, warning := range s.Warnings {
+				fmt.Fprintf(w, "      - %s\n", warning)
+			}
+		}
 	}
+}
 
-	// Step 1: obtain information about the input file
-	packageName, structs, err := GetFileInfo(inputPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error getting file info: %s\n", err)
-		return
+// Prints the given generated files to stdout.
+func printFiles(files map[string][]byte) {
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
 	}
+	sort.Strings(paths)
 
-	if *verbose {
-		fmt.Fprintf(os.Stderr, "Package Name  : %s\n", packageName)
-		for _, s := range structs {
-			fmt.Fprintf(os.Stderr, "  Struct      : %s\n", s)
-		}
+	for _, path := range paths {
+		os.Stdout.Write(files[path])
 	}
+}
 
-	// Step 2: Find the import path of this file
-	importPath, err := getImportPath(inputPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't find input file in $GOPATH\n")
-		return
-	}
+// Prints an error and exits with a non-zero status, so that a -check that
+// can't generate the files fails too.
+func fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format, args...)
+	os.Exit(1)
+}
 
-	if *verbose {
-		fmt.Fprintf(os.Stderr, "Import Path   : %s\n", importPath)
+// Compares the generated files with the ones on disk and returns a diff of
+// any that are different, which is empty if they're all up to date.
+func diffFiles(files map[string][]byte) (string, error) {
+	paths := []string{}
+	for path := range files {
+		paths = append(paths, path)
 	}
+	sort.Strings(paths)
+
+	diffs := ""
+	for _, path := range paths {
+		name := filepath.ToSlash(path)
+		existing, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			existing, name = nil, "/dev/null"
+		} else if err != nil {
+			return "", err
+		}
 
-	// Step 3: Generate a template that will extract information about each of
-	// the structs we've already found.
-	tmpl := template.Must(template.New("gather_gen.go").Parse(gatherTemplate))
-	gatherFile := bytes.Buffer{}
-	err = tmpl.Execute(&gatherFile, struct {
-		ImportPath  string
-		PackageName string
-		StructNames []string
-	}{importPath, packageName, structs})
+		diffs += common.UnifiedDiff(name, filepath.ToSlash(path), existing, files[path])
+	}
+	return diffs, nil
+}
 
+// Loads the given input files and generates their output, along with the
+// output of any plugins, which is returned separately.  With -v, progress is
+// printed to log.
+func generate(inputs []string, opts generator.Options, log io.Writer) (*generator.Model, map[string][]byte, map[string][]byte, error) {
+	model, err := generator.Load(inputs, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't execute template: %s\n", err)
-		return
+		return nil, nil, nil, err
 	}
 
-	// Step 4: Create a temporary file and write the formatted code to it.
-	tmpFile, err := common.TempFileWithSuffix("", "gather_gen", ".go")
+	files, pluginFiles, err := generateModel(model, log)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't create temp file: %s\n", err)
-		return
-	}
-	// Order is LIFO, so we remove and then close, so the order is Close then
-	// remove.
-	if !*keepGenerated {
-		defer os.Remove(tmpFile.Name())
+		return nil, nil, nil, err
 	}
-	defer tmpFile.Close()
+	return model, files, pluginFiles, nil
+}
 
+// Generates the output of a model that has been loaded, along with the output
+// of any plugins, which is returned separately.  With -v, progress is printed
+// to log.
+func generateModel(model *generator.Model, log io.Writer) (map[string][]byte, map[string][]byte, error) {
 	if *verbose {
-		fmt.Fprintf(os.Stderr, "Temp File     : %s\n", tmpFile.Name())
+		for _, f := range model.Files {
+			printStructs(log, f.Structs)
+		}
 	}
 
-	err = common.GoFmt(tmpFile, &gatherFile)
+	backend, err := generator.BackendFor(model.Options.Router)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't format generated code: %s\n", err)
-		return
+		return nil, nil, err
 	}
 
-	// Step 5: Run this file
-	structInfoBuff := bytes.Buffer{}
-	errBuff := bytes.Buffer{}
-	cmd := exec.Command("go", "run", "-a", tmpFile.Name())
-	cmd.Stdout = &structInfoBuff
-	cmd.Stderr = &errBuff
-	err = cmd.Run()
+	files, err := generator.Generate(model, backend)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't run gather code: %s\n", err)
-		return
+		return nil, nil, err
 	}
 
-	// Step 6: Deserialize the struct info from the gather file.
-	structInfos := []common.StructInfo{}
-	err = json.NewDecoder(&structInfoBuff).Decode(&structInfos)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't decode json from gather: %s\n", err)
+	// Run any plugins on the gathered resources.
+	names := []string{}
+	for name := range model.Options.Plugins {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+
+	pluginFiles := map[string][]byte{}
+	for _, name := range names {
+		generated, err := generator.Generate(model, generator.Plugin{
+			Name:    name,
+			Options: model.Options.Plugins[name],
+		})
+		if err != nil {
+			return nil, nil, err
+		}
 
-	if *verbose {
-		fmt.Fprintf(os.Stderr, "Valid Structs : %d\n", len(structInfos))
-		for _, s := range structInfos {
-			fmt.Fprintf(os.Stderr, "  Struct '%s'\n", s.StructName)
-
-			fmt.Fprintf(os.Stderr, "    Handlers   : ")
-			for i, handler := range s.Handlers {
-				if i > 0 {
-					fmt.Fprintf(os.Stderr, ", ")
-				}
-				fmt.Fprintf(os.Stderr, "%s/%d", handler.Name, handler.Params)
-			}
-			fmt.Fprintf(os.Stderr, "\n")
-
-			fmt.Fprintf(os.Stderr, "    BeforeOne  : %t\n", s.BeforeOne != nil)
-			fmt.Fprintf(os.Stderr, "    BeforeMany : %t\n", s.BeforeMany != nil)
-			fmt.Fprintf(os.Stderr, "    BeforeAll  : %t\n", s.BeforeAll != nil)
-
-			if len(s.Warnings) > 0 {
-				fmt.Fprintf(os.Stderr, "    Warnings   :\n")
-				for _, w := range s.Warnings {
-					fmt.Fprintf(os.Stderr, "      - %s\n", w)
-				}
+		for path, contents := range generated {
+			if *verbose {
+				fmt.Fprintf(log, "Plugin File   : %s (%s)\n", path, name)
 			}
+			pluginFiles[path] = contents
 		}
 	}
 
-	// Step 7a: Optionally open the output file.
-	var outFile io.Writer
-	if *writeToStdout {
-		outFile = os.Stdout
-	} else {
-		f, err := os.Create(outputPath)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "couldn't create output file: %s\n", err)
-			return
-		}
-		defer f.Close()
+	return files, pluginFiles, nil
+}
 
-		outFile = f
+// Returns a clearer error if the given one came from overwriting a file that
+// wasn't generated.
+func writeError(err error) error {
+	if errors.Is(err, generator.ErrNotGenerated) {
+		return fmt.Errorf("%s (use -force to overwrite it)", err)
 	}
+	return err
+}
 
-	// Step 7b: Generate the final output
-	funcMap := template.FuncMap{
-		"RegisterFuncFor": RegisterFuncFor,
-		"UrlFor":          UrlFor,
-		"HasBeforeType":   HasBeforeType,
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "routes" {
+		routesMain(os.Args[2:])
+		return
 	}
-	tmpl = template.Must(template.New("gather_gen.go").
-		Funcs(funcMap).
-		Parse(finalTemplate))
 
-	finalBuff := bytes.Buffer{}
-	err = tmpl.Execute(&finalBuff, struct {
-		PackageName string
-		Structs     []common.StructInfo
-		UrlPrefix   string
-	}{packageName, structInfos, *prefix})
+	flag.Parse()
+	args := flag.Args()
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't execute template: %s\n", err)
-		return
+	if len(args) == 0 {
+		usage()
+	}
+	if *watchFlag && (*check || *showDiff || *writeToStdout) {
+		fatalf("-watch can't be used with -check, -diff or -stdout\n")
 	}
 
-	err = common.GoFmt(outFile, &finalBuff)
+	opts := generator.Options{
+		KeepTemp: *keepGenerated,
+		Mod:      *mod,
+		Timeout:  *timeout,
+		CacheDir: *cacheDir,
+		NoCache:  *noCache,
+	}
+	if *tags != "" {
+		opts.Tags = strings.Split(*tags, ",")
+	}
+
+	pkgs, err := loadPackages(args, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "couldn't format final code: %s\n", err)
+		fatalf("%s\n", err)
+	}
+
+	if *watchFlag {
+		if err := watch(pkgs); err != nil {
+			fatalf("%s\n", err)
+		}
 		return
 	}
+
+	results := generatePackages(pkgs, *jobs)
+	if len(pkgs) > 1 {
+		printSummary(os.Stderr, results)
+	}
+
+	// Diffs and generated files are printed in the order that the packages
+	// were given, whichever finished first.  Packages that failed have
+	// already had their errors printed, so they aren't reported as out of
+	// date.
+	failures, outdated := 0, 0
+	for _, r := range results {
+		fmt.Print(r.diff)
+		printFiles(r.files)
+
+		switch r.status {
+		case failed:
+			failures++
+		case outOfDate:
+			outdated++
+		}
+	}
+	if outdated > 0 && *check {
+		fmt.Fprintf(os.Stderr, "generated files are out of date\n")
+	}
+	if failures > 0 || (outdated > 0 && *check) {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/andrew-d/sleepywolf/generator"
+)
+
+// A package that's generated, which is the input files in one directory
+// along with the options for that directory.
+type pkg struct {
+	Dir    string
+	Inputs []string
+	Opts   generator.Options
+
+	// If the options couldn't be loaded, the error
+	Err error
+
+	// The fingerprint of the package's files, once it's been found
+	fingerprint string
+}
+
+// Finds the input files matching the given patterns, and groups them into
+// packages in the order that they were first given.
+func loadPackages(patterns []string, opts generator.Options) ([]*pkg, error) {
+	inputs, err := generator.ExpandPatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := []*pkg{}
+	byDir := map[string]*pkg{}
+	for _, input := range inputs {
+		dir := filepath.Clean(filepath.Dir(input))
+		p := byDir[dir]
+		if p == nil {
+			p = &pkg{Dir: dir, Opts: opts}
+			p.Opts.Options, p.Err = loadOptions(dir)
+			if p.Err != nil {
+				p.Err = fmt.Errorf("couldn't load configuration: %s", p.Err)
+			}
+			byDir[dir] = p
+			pkgs = append(pkgs, p)
+		}
+		p.Inputs = append(p.Inputs, input)
+	}
+	return pkgs, nil
+}
+
+// Returns whether the output of every input file in the package was
+// generated from the same inputs, in which case generating it would just give
+// the same thing.  Plugins' output doesn't record its inputs, so a package
+// with plugins is never up to date.  The package's fingerprint is kept, so
+// that it isn't found again when it's loaded.
+func (p *pkg) upToDate() (bool, error) {
+	if len(p.Opts.Plugins) > 0 {
+		return false, nil
+	}
+
+	// Every input file is in the same package, so they have the same
+	// fingerprint.
+	var err error
+	p.fingerprint, err = generator.Fingerprint(p.Inputs[0], p.Opts)
+	if err != nil {
+		return false, err
+	}
+
+	for _, input := range p.Inputs {
+		existing, err := os.ReadFile((&generator.File{Path: input}).Output())
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if generator.ReadFingerprint(existing) != p.fingerprint {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Returns the input for loading the package, with its progress logged to
+// log if -v was given.
+func (p *pkg) input(log io.Writer) generator.Input {
+	input := generator.Input{Patterns: p.Inputs, Options: p.Opts}
+	input.Options.Log = nil
+	if *verbose {
+		input.Options.Log = log
+	}
+	if p.fingerprint != "" {
+		input.Fingerprints = map[string]string{}
+		for _, path := range p.Inputs {
+			input.Fingerprints[path] = p.fingerprint
+		}
+	}
+	return input
+}
+
+// What happened to a package.
+type status int
+
+const (
+	generated status = iota
+	unchanged
+	outOfDate
+	failed
+)
+
+// The result of generating a package.
+type result struct {
+	pkg    *pkg
+	status status
+	err    error
+
+	// With -stdout, the generated files that weren't written
+	files map[string][]byte
+
+	// With -check or -diff, the differences from the files on disk
+	diff string
+}
+
+// Returns the result for a package that doesn't need to be generated, or nil
+// if it does.  With -incremental, packages whose output is up to date are
+// skipped, since if the output records the same inputs then generating it
+// would just give the same thing.  -check doesn't skip them on its own, since
+// a file that was edited by hand still records the same inputs.  Progress is
+// printed to log.
+func (p *pkg) skip(log io.Writer) *result {
+	if p.Err != nil {
+		return &result{pkg: p, status: failed, err: p.Err}
+	}
+	if *writeToStdout || !*incremental {
+		return nil
+	}
+
+	upToDate, err := p.upToDate()
+	if err != nil {
+		return &result{pkg: p, status: failed, err: err}
+	}
+	if !upToDate {
+		return nil
+	}
+	if *verbose {
+		fmt.Fprintf(log, "Up To Date    : %s\n", p.Dir)
+	}
+	return &result{pkg: p, status: unchanged}
+}
+
+// Generates the output of a package from its model, and writes it unless
+// -check, -diff or -stdout were given.  Progress is printed to log.
+func (p *pkg) generate(model *generator.Model, log io.Writer) *result {
+	r := &result{pkg: p}
+	files, pluginFiles, err := generateModel(model, log)
+	if err != nil {
+		r.status, r.err = failed, err
+		return r
+	}
+
+	// With -check or -diff, nothing is written.
+	if *check || *showDiff {
+		all := map[string][]byte{}
+		for path, contents := range files {
+			all[path] = contents
+		}
+		for path, contents := range pluginFiles {
+			all[path] = contents
+		}
+
+		r.diff, err = diffFiles(all)
+		if err != nil {
+			r.status, r.err = failed, fmt.Errorf("couldn't compare output: %s", err)
+		} else if r.diff != "" {
+			r.status = outOfDate
+		} else {
+			r.status = unchanged
+		}
+		return r
+	}
+
+	if *writeToStdout {
+		fmt.Fprint(log, "Output File   : STDOUT\n")
+	} else {
+		for _, f := range model.Files {
+			fmt.Fprintf(log, "Output File   : %s\n", f.Output())
+		}
+	}
+
+	// Plugin files are always written, even with -stdout.  Everything else
+	// is written at once, so that a failure doesn't leave some of the files
+	// out of date.
+	if *writeToStdout {
+		r.files = files
+		files = map[string][]byte{}
+	}
+	for path, contents := range pluginFiles {
+		files[path] = contents
+	}
+
+	// Files that haven't changed aren't written again, so that their
+	// modification times don't change.
+	for path, contents := range files {
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, contents) {
+			delete(files, path)
+		}
+	}
+	if len(files) == 0 && !*writeToStdout {
+		r.status = unchanged
+		return r
+	}
+
+	if err := generator.WriteFiles(files, *force); err != nil {
+		r.status, r.err = failed, writeError(err)
+		return r
+	}
+	r.status = generated
+	return r
+}
+
+// Calls f with each index from 0 to n-1, with at most the given number of
+// calls running at once, and returns once they've all finished.
+func runParallel(n, jobs int, f func(i int)) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range work {
+				f(j)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+}
+
+// Generates the given packages with at most the given number running at
+// once, and returns their results in the same order.  Packages that don't
+// need generating are found first, and the rest are parsed, and then their
+// resources are found together (see generator.GatherAll), so that one gather
+// program is built for them.  Each package's progress is printed once it has
+// finished, so that the output of packages that run at the same time isn't
+// mixed up.
+func generatePackages(pkgs []*pkg, jobs int) []*result {
+	results := make([]*result, len(pkgs))
+	logs := make([]*bytes.Buffer, len(pkgs))
+	var mu sync.Mutex
+	finish := func(i int, r *result) {
+		results[i] = r
+		mu.Lock()
+		defer mu.Unlock()
+		os.Stderr.Write(logs[i].Bytes())
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", r.err)
+		}
+	}
+
+	// Step 1: Skip the packages that don't need generating.
+	runParallel(len(pkgs), jobs, func(i int) {
+		logs[i] = &bytes.Buffer{}
+		if r := pkgs[i].skip(logs[i]); r != nil {
+			finish(i, r)
+		}
+	})
+
+	// Step 2: Parse the others, and then gather their resources together.
+	loading := []int{}
+	for i := range pkgs {
+		if results[i] == nil {
+			loading = append(loading, i)
+		}
+	}
+	models := make([]*generator.Model, len(loading))
+	errs := make([]error, len(loading))
+	runParallel(len(loading), jobs, func(j int) {
+		i := loading[j]
+		models[j], errs[j] = generator.Parse(pkgs[i].input(logs[i]))
+	})
+	for j, err := range generator.GatherAll(models) {
+		if err != nil {
+			errs[j] = err
+		}
+	}
+
+	// Step 3: Generate and write them.
+	runParallel(len(loading), jobs, func(j int) {
+		i := loading[j]
+		if errs[j] != nil {
+			finish(i, &result{pkg: pkgs[i], status: failed, err: errs[j]})
+			return
+		}
+		finish(i, pkgs[i].generate(models[j], logs[i]))
+	})
+	return results
+}
+
+// Prints how many packages were generated, unchanged, out of date and
+// failed, and the failed packages, to w.
+func printSummary(w io.Writer, results []*result) {
+	counts := map[status]int{}
+	failedDirs := []string{}
+	for _, r := range results {
+		counts[r.status]++
+		if r.status == failed {
+			failedDirs = append(failedDirs, r.pkg.Dir)
+		}
+	}
+
+	fmt.Fprintf(w, "Packages      : %d generated, %d unchanged", counts[generated], counts[unchanged])
+	if counts[outOfDate] > 0 {
+		fmt.Fprintf(w, ", %d out of date", counts[outOfDate])
+	}
+	fmt.Fprintf(w, ", %d failed\n", counts[failed])
+	if len(failedDirs) > 0 {
+		fmt.Fprintf(w, "Failed        : %s\n", strings.Join(failedDirs, ", "))
+	}
+}
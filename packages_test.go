@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/sleepywolf/generator"
+)
+
+func TestLoadPackages(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(contents), 0644))
+		return path
+	}
+
+	users := write("users/users.go", "package users\n")
+	todos := write("todos/todos.go", "package todos\n")
+	items := write("todos/items.go", "package todos\n")
+	write("broken/sleepywolf.yaml", "prefix: [\n")
+	broken := write("broken/broken.go", "package broken\n")
+
+	// Packages are in the order that they're first given, and each has its
+	// own options.
+	opts := generator.Options{Mod: "vendor"}
+	pkgs, err := loadPackages([]string{users, filepath.Join(dir, "todos", "*.go"), broken}, opts)
+	if !assert.NoError(t, err) || !assert.Len(t, pkgs, 3) {
+		return
+	}
+
+	assert.Equal(t, filepath.Dir(users), pkgs[0].Dir)
+	assert.Equal(t, []string{users}, pkgs[0].Inputs)
+	assert.Equal(t, "vendor", pkgs[0].Opts.Mod)
+	assert.Equal(t, "/api", pkgs[0].Opts.Prefix)
+	assert.NoError(t, pkgs[0].Err)
+
+	assert.Equal(t, []string{items, todos}, pkgs[1].Inputs)
+
+	assert.Equal(t, []string{broken}, pkgs[2].Inputs)
+	assert.Error(t, pkgs[2].Err)
+}
+
+func TestRunParallel(t *testing.T) {
+	var mu sync.Mutex
+	running, most := 0, 0
+	done := make([]bool, 20)
+
+	runParallel(len(done), 3, func(i int) {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		done[i] = true
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	})
+
+	for i, ok := range done {
+		assert.True(t, ok, "%d wasn't run", i)
+	}
+	assert.LessOrEqual(t, most, 3)
+}
+
+func TestSkip(t *testing.T) {
+	defer func(c, i bool) { *check, *incremental = c, i }(*check, *incremental)
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "todos.go")
+	assert.NoError(t, os.WriteFile(input, []byte("package todos\n"), 0644))
+	p := &pkg{Dir: dir, Inputs: []string{input}}
+
+	// The output records the same inputs, but may have been edited since.
+	fingerprint, err := generator.Fingerprint(input, p.Opts)
+	assert.NoError(t, err)
+	output := "// Code generated by sleepywolf; DO NOT EDIT.\n// Input: " + fingerprint + "\n\npackage todos\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "todos_goji.go"), []byte(output), 0644))
+
+	// -check always generates the package to compare it, and -incremental
+	// skips it.
+	*check, *incremental = true, false
+	assert.Nil(t, p.skip(&bytes.Buffer{}))
+
+	*check, *incremental = false, true
+	if r := p.skip(&bytes.Buffer{}); assert.NotNil(t, r) {
+		assert.Equal(t, unchanged, r.status)
+	}
+}
+
+func TestGeneratePackagesFailed(t *testing.T) {
+	// Packages whose options couldn't be loaded fail without being loaded.
+	pkgs := []*pkg{
+		{Dir: "a", Err: errors.New("bad config")},
+		{Dir: "b", Err: errors.New("bad config")},
+	}
+	results := generatePackages(pkgs, 2)
+	if assert.Len(t, results, 2) {
+		for i, r := range results {
+			assert.Equal(t, pkgs[i], r.pkg)
+			assert.Equal(t, failed, r.status)
+			assert.EqualError(t, r.err, "bad config")
+		}
+	}
+}
+
+func TestPrintSummary(t *testing.T) {
+	results := []*result{
+		{pkg: &pkg{Dir: "todos"}, status: generated},
+		{pkg: &pkg{Dir: "users"}, status: failed},
+		{pkg: &pkg{Dir: "items"}, status: unchanged},
+		{pkg: &pkg{Dir: "tags"}, status: failed},
+	}
+
+	w := &bytes.Buffer{}
+	printSummary(w, results)
+	assert.Equal(t, "Packages      : 1 generated, 1 unchanged, 2 failed\n"+
+		"Failed        : users, tags\n", w.String())
+
+	w.Reset()
+	printSummary(w, []*result{{pkg: &pkg{Dir: "todos"}, status: outOfDate}})
+	assert.Equal(t, "Packages      : 0 generated, 0 unchanged, 1 out of date, 0 failed\n", w.String())
+}
@@ -0,0 +1,149 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// MaxBatchSize is the largest number of requests that a batch may contain.
+var MaxBatchSize = 100
+
+// MaxBatchRequestSize is the largest body that a batch request may have.
+// Larger batches get a 413.
+var MaxBatchRequestSize int64 = 10 << 20
+
+// The headers of a batch request that its sub-requests don't inherit, because
+// they only apply to the batch request itself.  Sub-requests can still set
+// them in their own headers.
+var batchOnlyHeaders = []string{
+	"Content-Length",
+	"Content-Type",
+	"Idempotency-Key",
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Unmodified-Since",
+}
+
+// BatchRequest is a single request in the body of a batch request.
+type BatchRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// BatchResponse is the response to a single BatchRequest.  The body is
+// embedded directly if it's JSON, and as a string otherwise.
+type BatchResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// Runs a single request of a batch against the handler.
+func runBatchRequest(h http.Handler, parent *http.Request, self string, br BatchRequest) BatchResponse {
+	if br.Method == "" || !strings.HasPrefix(br.Path, "/") {
+		return batchError(http.StatusBadRequest, "each request needs a method and an absolute path")
+	}
+
+	r, err := http.NewRequest(strings.ToUpper(br.Method), br.Path, bytes.NewReader(br.Body))
+	if err != nil {
+		return batchError(http.StatusBadRequest, err.Error())
+	}
+
+	// The path is compared after it's decoded, in the same way that it's
+	// routed, so that e.g. "/api/%62atch" is caught too.  BatchHandler also
+	// rejects requests that are part of a batch, in case the mux routes
+	// another path to it.
+	if r.URL.Path == self {
+		return batchError(http.StatusBadRequest, "batch requests can't be nested")
+	}
+	r = r.WithContext(context.WithValue(parent.Context(), batchContextKey, true))
+	r.RemoteAddr = parent.RemoteAddr
+
+	// Sub-requests inherit the headers of the batch request, such as those
+	// used for authentication, except for the ones that only apply to it.
+	for k, v := range parent.Header {
+		r.Header[k] = v
+	}
+	for _, k := range batchOnlyHeaders {
+		r.Header.Del(k)
+	}
+	if len(br.Body) > 0 {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range br.Headers {
+		r.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	resp := BatchResponse{Status: rec.Code, Headers: map[string]string{}}
+	for k := range rec.Header() {
+		resp.Headers[k] = rec.Header().Get(k)
+	}
+
+	body := rec.Body.Bytes()
+	mt, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if len(body) > 0 {
+		if (mt == "application/json" || strings.HasSuffix(mt, "+json")) && json.Valid(body) {
+			resp.Body = body
+		} else {
+			resp.Body, _ = json.Marshal(string(body))
+		}
+	}
+	return resp
+}
+
+func batchError(status int, msg string) BatchResponse {
+	body, _ := json.Marshal(Error{Message: msg})
+	return BatchResponse{Status: status, Body: body}
+}
+
+// BatchHandler returns a handler for batch requests, which dispatches each of
+// the requests in the body to h, and responds with their results in order.
+// The body is a JSON array of BatchRequest, and the response is a JSON array
+// of BatchResponse.  The handler is registered at the given path, and
+// requests to that path can't be included in a batch.  Batches with more than
+// MaxBatchSize requests get a 400, and those with a body larger than
+// MaxBatchRequestSize get a 413.
+func BatchHandler(h http.Handler, path string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if nested, _ := r.Context().Value(batchContextKey).(bool); nested {
+			http.Error(w, "batch requests can't be nested", http.StatusBadRequest)
+			return
+		}
+
+		reqs := []BatchRequest{}
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBatchRequestSize)).Decode(&reqs)
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, fmt.Sprintf("malformed batch: %s", err), http.StatusBadRequest)
+			return
+		}
+		if len(reqs) > MaxBatchSize {
+			http.Error(w, fmt.Sprintf("a batch may contain at most %d requests", MaxBatchSize),
+				http.StatusBadRequest)
+			return
+		}
+
+		resps := []BatchResponse{}
+		for _, br := range reqs {
+			resps = append(resps, runBatchRequest(h, r, path, br))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resps)
+	}
+}
@@ -0,0 +1,98 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenazn/goji/web"
+)
+
+func TestBatchHandler(t *testing.T) {
+	mux := web.New()
+	mux.Get("/api/foo/:id", func(c web.C, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "` + c.URLParams["id"] + `", "auth": "` + r.Header.Get("Authorization") + `"}`))
+	})
+	mux.Post("/api/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("type=" + r.Header.Get("Content-Type")))
+	})
+	mux.Post("/api/batch", BatchHandler(mux, "/api/batch"))
+
+	r, _ := http.NewRequest("POST", "/api/batch", strings.NewReader(`[
+		{"method": "GET", "path": "/api/foo/1"},
+		{"method": "post", "path": "/api/foo", "body": {"a": 1}},
+		{"method": "GET", "path": "/api/bar"},
+		{"method": "POST", "path": "/api/batch", "body": []},
+		{"method": "GET"}
+	]`))
+	r.Header.Set("Authorization", "secret")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"status": 200, "headers": {"Content-Type": "application/json"}, "body": {"id": "1", "auth": "secret"}},
+		{"status": 201, "body": "type=application/json"},
+		{"status": 404, "headers": {"Content-Type": "text/plain; charset=utf-8", "X-Content-Type-Options": "nosniff"}, "body": "404 page not found\n"},
+		{"status": 400, "body": {"error": "batch requests can't be nested"}},
+		{"status": 400, "body": {"error": "each request needs a method and an absolute path"}}
+	]`, w.Body.String())
+
+	r, _ = http.NewRequest("POST", "/api/batch", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBatchHandlerNested(t *testing.T) {
+	mux := web.New()
+	mux.Get("/api/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("key=" + r.Header.Get("Idempotency-Key") + " match=" + r.Header.Get("If-Match") +
+			" auth=" + r.Header.Get("Authorization")))
+	})
+	mux.Post("/api/batch", BatchHandler(mux, "/api/batch"))
+	mux.Post("/api/other", BatchHandler(mux, "/api/other"))
+
+	r, _ := http.NewRequest("POST", "/api/batch", strings.NewReader(`[
+		{"method": "POST", "path": "/api/%62atch", "body": []},
+		{"method": "POST", "path": "/api/other", "body": []},
+		{"method": "GET", "path": "/api/foo"},
+		{"method": "GET", "path": "/api/foo", "headers": {"Idempotency-Key": "sub"}}
+	]`))
+	r.Header.Set("Authorization", "secret")
+	r.Header.Set("Idempotency-Key", "parent")
+	r.Header.Set("If-Match", `"v1"`)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	// Nested batches are rejected however they're routed, and sub-requests
+	// don't inherit the headers that only apply to the batch.
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[
+		{"status": 400, "body": {"error": "batch requests can't be nested"}},
+		{"status": 400, "headers": {"Content-Type": "text/plain; charset=utf-8", "X-Content-Type-Options": "nosniff"}, "body": "batch requests can't be nested\n"},
+		{"status": 200, "headers": {"Content-Type": "text/plain; charset=utf-8"}, "body": "key= match= auth=secret"},
+		{"status": 200, "headers": {"Content-Type": "text/plain; charset=utf-8"}, "body": "key=sub match= auth=secret"}
+	]`, w.Body.String())
+}
+
+func TestBatchHandlerLimits(t *testing.T) {
+	defer func(size int, bytes int64) { MaxBatchSize, MaxBatchRequestSize = size, bytes }(MaxBatchSize, MaxBatchRequestSize)
+	MaxBatchSize, MaxBatchRequestSize = 1, 100
+	handler := BatchHandler(web.New(), "/api/batch")
+
+	for body, status := range map[string]int{
+		`[{"method": "GET", "path": "/a"}]`:                                  http.StatusOK,
+		`[{"method": "GET", "path": "/a"}, {"method": "GET", "path": "/b"}]`: http.StatusBadRequest,
+		`[{"method": "GET", "path": "/` + strings.Repeat("a", 100) + `"}]`:   http.StatusRequestEntityTooLarge,
+	} {
+		r, _ := http.NewRequest("POST", "/api/batch", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler(w, r)
+		assert.Equal(t, status, w.Code, body)
+	}
+}
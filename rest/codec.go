@@ -0,0 +1,188 @@
+package rest
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Codec encodes and decodes values of a single media type.  Formats that
+// aren't built in, such as MessagePack or CBOR, can be supported by
+// implementing this interface and adding the codec to a Registry.
+type Codec interface {
+	// The media type handled by this codec.  It may contain parameters, e.g.
+	// "application/vnd.example+json; version=2".
+	MediaType() string
+
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string                       { return "application/json" }
+func (jsonCodec) Encode(w io.Writer, v interface{}) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v interface{}) error { return json.NewDecoder(r).Decode(v) }
+
+type xmlCodec struct{}
+
+func (xmlCodec) MediaType() string                       { return "application/xml" }
+func (xmlCodec) Encode(w io.Writer, v interface{}) error { return xml.NewEncoder(w).Encode(v) }
+func (xmlCodec) Decode(r io.Reader, v interface{}) error { return xml.NewDecoder(r).Decode(v) }
+
+var (
+	// JSON encodes and decodes "application/json" using encoding/json.
+	JSON Codec = jsonCodec{}
+
+	// XML encodes and decodes "application/xml" using encoding/xml.
+	XML Codec = xmlCodec{}
+)
+
+// Registry is an ordered list of codecs.  A resource enables content
+// negotiation by defining a method of the form:
+//
+//	func (f *FooResource) Codecs() *rest.Registry
+//
+// The first codec is used when the client has no preference.
+type Registry struct {
+	codecs []Codec
+}
+
+// NewRegistry creates a registry containing the given codecs.
+func NewRegistry(codecs ...Codec) *Registry {
+	return &Registry{codecs: codecs}
+}
+
+// Register adds a codec to the end of the registry.
+func (r *Registry) Register(c Codec) {
+	r.codecs = append(r.codecs, c)
+}
+
+// MediaTypes returns the media types of the registered codecs, in order.
+func (r *Registry) MediaTypes() []string {
+	ret := []string{}
+	for _, c := range r.codecs {
+		ret = append(ret, c.MediaType())
+	}
+	return ret
+}
+
+// A single media range from an "Accept" header.
+type mediaRange struct {
+	mediaType string
+	params    map[string]string
+	q         float64
+}
+
+// Parses an "Accept" header into its media ranges.  Ranges that can't be
+// parsed are ignored.
+func parseAccept(accept string) []mediaRange {
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if qs, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qs, 64); err != nil {
+				continue
+			}
+			delete(params, "q")
+		}
+		ranges = append(ranges, mediaRange{mt, params, q})
+	}
+	return ranges
+}
+
+// Returns how specific a media range is.  When several ranges match a media
+// type, the most specific one determines its quality.
+func (m mediaRange) specificity() int {
+	switch {
+	case m.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(m.mediaType, "/*"):
+		return 1
+	}
+	return 2 + len(m.params)
+}
+
+// Returns whether the codec's media type falls within the given range.  Every
+// parameter of the range must be present on the media type with the same
+// value.
+func (m mediaRange) matches(c Codec) bool {
+	mt, params, err := mime.ParseMediaType(c.MediaType())
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case m.mediaType == "*/*":
+	case strings.HasSuffix(m.mediaType, "/*"):
+		if !strings.HasPrefix(mt, strings.TrimSuffix(m.mediaType, "*")) {
+			return false
+		}
+	case m.mediaType != mt:
+		return false
+	}
+
+	for k, v := range m.params {
+		if params[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ForAccept returns the codec that best satisfies the given "Accept" header,
+// or nil if none of the codecs are acceptable.  Codecs that are equally
+// acceptable are chosen in the order that they were registered.
+func (r *Registry) ForAccept(accept string) Codec {
+	if len(r.codecs) == 0 {
+		return nil
+	}
+	if strings.TrimSpace(accept) == "" {
+		return r.codecs[0]
+	}
+
+	ranges := parseAccept(accept)
+
+	var best Codec
+	bestQ := 0.0
+	for _, c := range r.codecs {
+		q, spec := 0.0, -1
+		for _, m := range ranges {
+			if m.matches(c) && m.specificity() > spec {
+				q, spec = m.q, m.specificity()
+			}
+		}
+		if q > bestQ {
+			best, bestQ = c, q
+		}
+	}
+	return best
+}
+
+// ForContentType returns the codec for the given "Content-Type" header, or nil
+// if none of the codecs can decode it.
+func (r *Registry) ForContentType(contentType string) Codec {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	// The charset doesn't affect which codec is used.
+	delete(params, "charset")
+
+	m := mediaRange{mediaType: mt, params: params}
+	for _, c := range r.codecs {
+		if m.matches(c) {
+			return c
+		}
+	}
+	return nil
+}
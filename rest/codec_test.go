@@ -0,0 +1,45 @@
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedCodec struct {
+	version string
+}
+
+func (c versionedCodec) MediaType() string {
+	return "application/vnd.example+json; version=" + c.version
+}
+func (c versionedCodec) Encode(w io.Writer, v interface{}) error { return json.NewEncoder(w).Encode(v) }
+func (c versionedCodec) Decode(r io.Reader, v interface{}) error { return json.NewDecoder(r).Decode(v) }
+
+func TestRegistryForAccept(t *testing.T) {
+	v1 := versionedCodec{"1"}
+	v2 := versionedCodec{"2"}
+	reg := NewRegistry(JSON, XML, v1, v2)
+
+	assert.Equal(t, JSON, reg.ForAccept(""))
+	assert.Equal(t, JSON, reg.ForAccept("*/*"))
+	assert.Equal(t, XML, reg.ForAccept("application/xml"))
+	assert.Equal(t, XML, reg.ForAccept("application/json;q=0.5, application/xml"))
+	assert.Equal(t, XML, reg.ForAccept("text/html, application/*;q=0.9, application/json;q=0"))
+	assert.Equal(t, v1, reg.ForAccept("application/vnd.example+json"))
+	assert.Equal(t, v2, reg.ForAccept("application/vnd.example+json; version=2"))
+	assert.Nil(t, reg.ForAccept("application/vnd.example+json; version=3"))
+	assert.Nil(t, reg.ForAccept("text/html"))
+}
+
+func TestRegistryForContentType(t *testing.T) {
+	reg := NewRegistry(JSON, versionedCodec{"1"})
+
+	assert.Equal(t, JSON, reg.ForContentType("application/json"))
+	assert.Equal(t, JSON, reg.ForContentType("application/json; charset=utf-8"))
+	assert.Equal(t, versionedCodec{"1"}, reg.ForContentType("application/vnd.example+json; version=1"))
+	assert.Nil(t, reg.ForContentType("application/msgpack"))
+	assert.Nil(t, reg.ForContentType(""))
+}
@@ -0,0 +1,111 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Versioned is implemented by values that have an entity tag.  A resource can
+// implement it to enable conditional requests on its GetOne, Put, Patch and
+// DeleteOne handlers, which is evaluated after the Before functions have run.
+// Typed GetOne handlers can also return a Versioned value instead.
+type Versioned interface {
+	ETag() string
+}
+
+// Quotes an entity tag, unless it already is.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// Returns whether the given "If-Match" or "If-None-Match" header contains the
+// entity tag.  Weak tags only match if weak is true.
+func etagMatches(header, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	strip := func(t string) (string, bool) {
+		return strings.TrimPrefix(t, "W/"), strings.HasPrefix(t, "W/")
+	}
+	want, wantWeak := strip(etag)
+	for _, t := range strings.Split(header, ",") {
+		have, haveWeak := strip(strings.TrimSpace(t))
+		if have == want && (weak || (!wantWeak && !haveWeak)) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckConditions evaluates the conditional headers of a request against the
+// current entity tag of the resource.  For GET and HEAD requests the "ETag"
+// header is set and a matching "If-None-Match" results in a 304 Not Modified.
+// For other methods an "If-Match" that doesn't match, or an "If-None-Match"
+// that does, results in a 412 Precondition Failed.  It returns false if a
+// response has been written.
+func CheckConditions(w http.ResponseWriter, r *http.Request, etag string) bool {
+	etag = quoteETag(etag)
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if etag != `""` {
+			w.Header().Set("ETag", etag)
+		}
+		if ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return false
+		}
+		return true
+	}
+
+	if (ifMatch != "" && !etagMatches(ifMatch, etag, false)) ||
+		(ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true)) {
+		http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// Sets the "ETag" header of a successful response to the entity tag of a
+// Versioned value, as it is when the response is written.  A tag that's
+// already set, e.g. by the handler or by an etagWriter wrapping this one, is
+// left alone, and an empty tag is never set.
+type etagWriter struct {
+	http.ResponseWriter
+	v           Versioned
+	wroteHeader bool
+}
+
+func (w *etagWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status >= 200 && status < 300 && w.Header().Get("ETag") == "" {
+			if etag := w.v.ETag(); etag != "" {
+				w.Header().Set("ETag", quoteETag(etag))
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *etagWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ETagWriter returns a ResponseWriter that sets the "ETag" header of 2xx
+// responses to the entity tag of v, unless it's empty or the header is
+// already set.  It's used for the Put and Patch handlers of resources that
+// implement Versioned, so that the response carries the entity tag after the
+// change.  WriteResult wraps it again for a Versioned result, whose tag then
+// takes precedence.
+func ETagWriter(w http.ResponseWriter, v Versioned) http.ResponseWriter {
+	return &etagWriter{ResponseWriter: w, v: v}
+}
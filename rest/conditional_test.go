@@ -0,0 +1,89 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenazn/goji/web"
+)
+
+func TestCheckConditions(t *testing.T) {
+	check := func(method, header, value, etag string) (bool, *httptest.ResponseRecorder) {
+		r, _ := http.NewRequest(method, "/api/foo/1", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		return CheckConditions(w, r, etag), w
+	}
+
+	ok, w := check("GET", "", "", "v1")
+	assert.True(t, ok)
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+
+	ok, w = check("GET", "If-None-Match", `"v0", "v1"`, "v1")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	ok, _ = check("GET", "If-None-Match", `W/"v1"`, "v1")
+	assert.False(t, ok, "weak comparison is used for If-None-Match")
+
+	ok, _ = check("GET", "If-None-Match", `"v0"`, "v1")
+	assert.True(t, ok)
+
+	ok, w = check("PUT", "If-Match", `"v0"`, "v1")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, "", w.Header().Get("ETag"))
+
+	ok, _ = check("PUT", "If-Match", `W/"v1"`, "v1")
+	assert.False(t, ok, "strong comparison is used for If-Match")
+
+	ok, _ = check("PATCH", "If-Match", `"v1"`, "v1")
+	assert.True(t, ok)
+
+	ok, _ = check("DELETE", "If-Match", `*`, `W/"v1"`)
+	assert.True(t, ok)
+
+	ok, w = check("PUT", "If-None-Match", `*`, "v1")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+type versioned struct {
+	Etag string `json:"etag"`
+}
+
+func (v *versioned) ETag() string { return v.Etag }
+
+func TestETagWriter(t *testing.T) {
+	// The entity tag is read when the response is written, after any
+	// changes.
+	v := &versioned{"1"}
+	w := httptest.NewRecorder()
+	ew := ETagWriter(w, v)
+	v.Etag = "2"
+	ew.Write([]byte("ok"))
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	ETagWriter(w, v).WriteHeader(http.StatusBadRequest)
+	assert.Equal(t, "", w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	assert.NoError(t, WriteResult(web.C{}, w, http.StatusOK, &versioned{"3"}))
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.Equal(t, `{"etag":"3"}`+"\n", w.Body.String())
+
+	// A Versioned result's tag takes precedence over the resource's.
+	w = httptest.NewRecorder()
+	assert.NoError(t, WriteResult(web.C{}, ETagWriter(w, &versioned{"1"}), http.StatusOK, &versioned{"2"}))
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// Empty tags aren't set.
+	w = httptest.NewRecorder()
+	ETagWriter(w, &versioned{""}).WriteHeader(http.StatusOK)
+	assert.Equal(t, "", w.Header().Get("ETag"))
+}
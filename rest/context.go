@@ -0,0 +1,35 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/zenazn/goji/web"
+)
+
+type contextKey int
+
+const (
+	webContextKey contextKey = iota
+
+	// Set on the requests that BatchHandler runs
+	batchContextKey
+)
+
+// NewContext returns the context passed to typed handlers.  It is derived
+// from the request's context, and carries Goji's context so that URL
+// parameters and the environment remain available.
+func NewContext(c web.C, r *http.Request) context.Context {
+	return context.WithValue(r.Context(), webContextKey, c)
+}
+
+// C returns the Goji context stored by NewContext.
+func C(ctx context.Context) web.C {
+	c, _ := ctx.Value(webContextKey).(web.C)
+	return c
+}
+
+// URLParam returns the value of the named URL parameter, such as "id".
+func URLParam(ctx context.Context, name string) string {
+	return C(ctx).URLParams[name]
+}
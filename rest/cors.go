@@ -0,0 +1,114 @@
+package rest
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which cross-origin requests a resource accepts.  A
+// resource declares its policy by defining a method of the form:
+//
+//	func (f *FooResource) CORS() rest.CORSPolicy
+//
+// The allowed methods are not part of the policy, since they are determined
+// by the handlers that the resource implements.
+type CORSPolicy struct {
+	// Origins that may make requests, or "*" to allow any origin.
+	AllowedOrigins []string
+
+	// Request headers that may be sent, or "*" to allow any header.
+	AllowedHeaders []string
+
+	// Response headers that the browser should expose to scripts.
+	ExposedHeaders []string
+
+	// Whether requests may include credentials, such as cookies.
+	AllowCredentials bool
+
+	// How long the result of a preflight request may be cached.  Zero means
+	// that the header isn't sent.
+	MaxAge time.Duration
+}
+
+func contains(list []string, s string, fold bool) bool {
+	for _, v := range list {
+		if v == "*" || v == s || (fold && strings.EqualFold(v, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets the headers that are common to preflight and actual requests.  Returns
+// false if the request's origin isn't allowed.
+func (p CORSPolicy) setOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	h := w.Header()
+	h.Add("Vary", "Origin")
+
+	if origin == "" || !contains(p.AllowedOrigins, origin, false) {
+		return false
+	}
+
+	// The wildcard can't be used with credentials, so echo the origin back.
+	if contains(p.AllowedOrigins, "*", false) && !p.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// SetHeaders adds the CORS response headers for an actual (i.e. not
+// preflight) request.  Nothing but "Vary" is added if the origin isn't
+// allowed.
+func (p CORSPolicy) SetHeaders(w http.ResponseWriter, r *http.Request) {
+	if !p.setOrigin(w, r) {
+		return
+	}
+	if len(p.ExposedHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+	}
+}
+
+// Preflight answers a CORS preflight request for a path that supports the
+// methods in allow, which is formatted like the "Allow" header.  It returns
+// false, without writing anything, if the request isn't a preflight request.
+func (p CORSPolicy) Preflight(w http.ResponseWriter, r *http.Request, allow string) bool {
+	method := r.Header.Get("Access-Control-Request-Method")
+	if r.Method != "OPTIONS" || r.Header.Get("Origin") == "" || method == "" {
+		return false
+	}
+
+	w.Header().Set("Allow", allow)
+	if !contains(strings.Split(allow, ", "), method, false) || !p.setOrigin(w, r) {
+		w.WriteHeader(http.StatusNoContent)
+		return true
+	}
+
+	// Only the requested headers that the policy allows are listed, so the
+	// browser will reject the request if any other header is required.
+	allowed := []string{}
+	for _, name := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && contains(p.AllowedHeaders, name, true) {
+			allowed = append(allowed, name)
+		}
+	}
+
+	h := w.Header()
+	h.Set("Access-Control-Allow-Methods", allow)
+	if len(allowed) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(allowed, ", "))
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
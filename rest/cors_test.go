@@ -0,0 +1,67 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	p := CORSPolicy{
+		AllowedOrigins:   []string{"https://example.com"},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           time.Minute,
+	}
+
+	r, _ := http.NewRequest("OPTIONS", "/api/foo", nil)
+	r.Header.Set("Origin", "https://example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Access-Control-Request-Headers", "content-type, X-Other")
+
+	w := httptest.NewRecorder()
+	assert.True(t, p.Preflight(w, r, "GET, OPTIONS, PUT"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, OPTIONS, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "60", w.Header().Get("Access-Control-Max-Age"))
+
+	// Methods that the path doesn't support aren't allowed.
+	r.Header.Set("Access-Control-Request-Method", "DELETE")
+	w = httptest.NewRecorder()
+	assert.True(t, p.Preflight(w, r, "GET, OPTIONS, PUT"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// Neither are other origins.
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	r.Header.Set("Origin", "https://evil.com")
+	w = httptest.NewRecorder()
+	assert.True(t, p.Preflight(w, r, "GET, OPTIONS, PUT"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+
+	// A plain OPTIONS request isn't a preflight request.
+	r.Header.Del("Access-Control-Request-Method")
+	w = httptest.NewRecorder()
+	assert.False(t, p.Preflight(w, r, "GET, OPTIONS, PUT"))
+}
+
+func TestCORSSetHeaders(t *testing.T) {
+	p := CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		ExposedHeaders: []string{"X-Total-Count"},
+	}
+
+	r, _ := http.NewRequest("GET", "/api/foo", nil)
+	r.Header.Set("Origin", "https://example.com")
+
+	w := httptest.NewRecorder()
+	p.SetHeaders(w, r)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Total-Count", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+}
@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/zenazn/goji/web"
+)
+
+// Error is an error with an associated HTTP status code.  Typed handlers can
+// return it to control the response that is sent.
+type Error struct {
+	Status  int    `json:"-" xml:"-"`
+	Message string `json:"error" xml:"error"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Errorf creates an Error with the given status code and formatted message.
+func Errorf(status int, format string, args ...interface{}) *Error {
+	return &Error{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// WriteError writes the response for an error returned from a typed handler.
+// An *Error is written with its own status code, and anything else results in
+// a 500 Internal Server Error without exposing the error's message.
+func WriteError(c web.C, w http.ResponseWriter, err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		e = &Error{
+			Status:  http.StatusInternalServerError,
+			Message: http.StatusText(http.StatusInternalServerError),
+		}
+	}
+	Respond(c, w, e.Status, e)
+}
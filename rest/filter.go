@@ -0,0 +1,257 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortKey is a single field of a sort order.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Sort is the order requested by the "sort" query parameter.  The parameter
+// is a comma-separated list of fields, each of which is sorted in descending
+// order if it starts with a "-", e.g. "-created_at,title".
+type Sort []SortKey
+
+// FilterField describes a single query parameter of a filter.
+type FilterField struct {
+	Name string
+	Type string
+}
+
+// Information about the fields of a filter struct.
+type filterSpec struct {
+	// Index of the struct field for each query parameter
+	fields map[string]int
+
+	// Index of the Sort field, or -1 if there isn't one
+	sortIndex int
+	sortKeys  []string
+
+	described []FilterField
+}
+
+var sortType = reflect.TypeOf(Sort{})
+
+// Returns whether values of the given type can be parsed from a query
+// parameter.
+func isFilterScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func parseFilterType(t reflect.Type) (*filterSpec, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("filter should be a pointer to a struct, not %s", t.String())
+	}
+
+	spec := &filterSpec{
+		fields:    map[string]int{},
+		sortIndex: -1,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if keys, ok := f.Tag.Lookup("sort"); ok {
+			if f.Type != sortType {
+				return nil, fmt.Errorf("field '%s' has a sort tag, but isn't a rest.Sort", f.Name)
+			}
+			spec.sortIndex = i
+			spec.sortKeys = strings.Split(keys, ",")
+			continue
+		}
+
+		name := f.Tag.Get("filter")
+		if name == "" {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr || ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if !isFilterScalar(ft) {
+			return nil, fmt.Errorf("field '%s' has unsupported type %s", f.Name, f.Type.String())
+		}
+		if name == "sort" {
+			return nil, fmt.Errorf("field '%s' can't use the name 'sort'", f.Name)
+		}
+		if _, dup := spec.fields[name]; dup {
+			return nil, fmt.Errorf("query parameter '%s' is used by more than one field", name)
+		}
+
+		spec.fields[name] = i
+		spec.described = append(spec.described, FilterField{Name: name, Type: f.Type.String()})
+	}
+	return spec, nil
+}
+
+// DescribeFilter returns the query parameters and sortable fields of a filter,
+// or an error if the filter is invalid.
+func DescribeFilter(dst interface{}) ([]FilterField, []string, error) {
+	t := reflect.TypeOf(dst)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil, nil, fmt.Errorf("filter should be a pointer to a struct, not %T", dst)
+	}
+
+	spec, err := parseFilterType(t.Elem())
+	if err != nil {
+		return nil, nil, err
+	}
+	return spec.described, spec.sortKeys, nil
+}
+
+// Parses a single query parameter value into the given scalar value.
+func setScalar(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
+
+// Sets a filter field from the values of its query parameter.  Slices accept
+// repeated parameters as well as comma-separated values.
+func setField(v reflect.Value, name string, values []string) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 0, len(values)))
+		for _, value := range values {
+			for _, s := range strings.Split(value, ",") {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := setScalar(elem, s); err != nil {
+					return Errorf(http.StatusBadRequest, "invalid value for '%s': %q", name, s)
+				}
+				v.Set(reflect.Append(v, elem))
+			}
+		}
+		return nil
+
+	case reflect.Ptr:
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	if len(values) > 1 {
+		return Errorf(http.StatusBadRequest, "query parameter '%s' may only be given once", name)
+	}
+	if err := setScalar(v, values[0]); err != nil {
+		return Errorf(http.StatusBadRequest, "invalid value for '%s': %q", name, values[0])
+	}
+	return nil
+}
+
+// Parses the "sort" query parameter, allowing only the given fields.
+func parseSort(values []string, allowed []string) (Sort, error) {
+	if len(values) > 1 {
+		return nil, Errorf(http.StatusBadRequest, "query parameter 'sort' may only be given once")
+	}
+
+	ret := Sort{}
+	for _, field := range strings.Split(values[0], ",") {
+		key := SortKey{Field: strings.TrimPrefix(field, "-")}
+		key.Desc = key.Field != field
+
+		ok := false
+		for _, a := range allowed {
+			ok = ok || a == key.Field
+		}
+		if !ok {
+			return nil, Errorf(http.StatusBadRequest, "can't sort by '%s', expected one of: %s",
+				key.Field, strings.Join(allowed, ", "))
+		}
+		ret = append(ret, key)
+	}
+	return ret, nil
+}
+
+// DecodeQuery parses the query parameters of a request into a filter, which
+// must be a pointer to a struct.  Fields tagged with `filter:"name"` are set
+// from the query parameter with that name, and a rest.Sort field tagged with
+// `sort:"field1,field2"` is set from the "sort" parameter.  Query parameters
+// that the filter doesn't define result in an *Error with a 400 status,
+// unless they're listed in ignore.
+func DecodeQuery(q url.Values, dst interface{}, ignore ...string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("filter should be a pointer to a struct, not %T", dst)
+	}
+	v = v.Elem()
+
+	spec, err := parseFilterType(v.Type())
+	if err != nil {
+		return err
+	}
+
+	// Parameters are processed in order so that errors are deterministic.
+	names := []string{}
+	for name := range q {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+outer:
+	for _, name := range names {
+		for _, ig := range ignore {
+			if name == ig {
+				continue outer
+			}
+		}
+
+		if name == "sort" && spec.sortIndex >= 0 {
+			s, err := parseSort(q[name], spec.sortKeys)
+			if err != nil {
+				return err
+			}
+			v.Field(spec.sortIndex).Set(reflect.ValueOf(s))
+			continue
+		}
+
+		idx, ok := spec.fields[name]
+		if !ok {
+			return Errorf(http.StatusBadRequest, "unknown query parameter '%s'", name)
+		}
+		if err := setField(v.Field(idx), name, q[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
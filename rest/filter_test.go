@@ -0,0 +1,75 @@
+package rest
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testFilter struct {
+	Status []string `filter:"status"`
+	Done   *bool    `filter:"done"`
+	Owner  int      `filter:"owner"`
+	Order  Sort     `sort:"created_at,title"`
+	Other  string
+}
+
+func TestDecodeQuery(t *testing.T) {
+	decode := func(q string, ignore ...string) (testFilter, error) {
+		v, _ := url.ParseQuery(q)
+		f := testFilter{}
+		err := DecodeQuery(v, &f, ignore...)
+		return f, err
+	}
+
+	f, err := decode("status=open,closed&status=new&done=true&owner=3&sort=-created_at,title")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"open", "closed", "new"}, f.Status)
+	if assert.NotNil(t, f.Done) {
+		assert.True(t, *f.Done)
+	}
+	assert.Equal(t, 3, f.Owner)
+	assert.Equal(t, Sort{{"created_at", true}, {"title", false}}, f.Order)
+
+	f, err = decode("limit=10", "limit")
+	assert.NoError(t, err)
+	assert.Nil(t, f.Done)
+
+	for q, msg := range map[string]string{
+		"limit=10":          "unknown query parameter 'limit'",
+		"Other=x":           "unknown query parameter 'Other'",
+		"owner=x":           `invalid value for 'owner': "x"`,
+		"owner=1&owner=2":   "query parameter 'owner' may only be given once",
+		"sort=-updated_at":  "can't sort by 'updated_at', expected one of: created_at, title",
+		"done=1&done=false": "query parameter 'done' may only be given once",
+	} {
+		_, err = decode(q)
+		if assert.Error(t, err, q) {
+			assert.Equal(t, msg, err.Error())
+			assert.Equal(t, http.StatusBadRequest, err.(*Error).Status)
+		}
+	}
+}
+
+func TestDescribeFilter(t *testing.T) {
+	fields, sortKeys, err := DescribeFilter(&testFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []FilterField{
+		{"status", "[]string"},
+		{"done", "*bool"},
+		{"owner", "int"},
+	}, fields)
+	assert.Equal(t, []string{"created_at", "title"}, sortKeys)
+
+	_, _, err = DescribeFilter(testFilter{})
+	assert.Error(t, err)
+
+	_, _, err = DescribeFilter(&struct {
+		Bad map[string]string `filter:"bad"`
+	}{})
+	if assert.Error(t, err) {
+		assert.Equal(t, "field 'Bad' has unsupported type map[string]string", err.Error())
+	}
+}
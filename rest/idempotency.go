@@ -0,0 +1,226 @@
+package rest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyInUse is returned from IdempotencyStore.Lock when another request
+// with the same key is still being processed.
+var ErrKeyInUse = errors.New("idempotency key is in use")
+
+// StoredResponse is a response saved in an IdempotencyStore.
+type StoredResponse struct {
+	// Hash of the request that the response belongs to, which is used to
+	// detect keys that are reused for a different request.
+	RequestHash string
+
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores the responses to requests with an "Idempotency-Key"
+// header.  A resource makes its Post handler idempotent by defining a method
+// of the form:
+//
+//	func (f *FooResource) IdempotencyStore() rest.IdempotencyStore
+//
+// If the method returns nil, DefaultIdempotencyStore is used.
+type IdempotencyStore interface {
+	// Lock reserves a key for the request with the given hash.  If a
+	// response has already been saved for the key, it is returned instead.
+	// If another request holds the key, ErrKeyInUse is returned.
+	Lock(key, hash string) (*StoredResponse, error)
+
+	// Save stores the response for a locked key and releases it.
+	Save(key string, resp *StoredResponse) error
+
+	// Unlock releases a locked key without storing a response, so that the
+	// request can be retried.
+	Unlock(key string) error
+}
+
+// MaxIdempotentRequestSize is the largest request body that Idempotent reads
+// to hash a request with an "Idempotency-Key" header.  Larger requests get a
+// 413.
+var MaxIdempotentRequestSize int64 = 10 << 20
+
+type memoryEntry struct {
+	resp    *StoredResponse
+	expires time.Time
+}
+
+// How often a MemoryIdempotencyStore removes the responses that have expired.
+const memorySweepInterval = time.Minute
+
+// MemoryIdempotencyStore is an IdempotencyStore that keeps responses in
+// memory.  It isn't suitable when requests are served by multiple processes.
+type MemoryIdempotencyStore struct {
+	ttl       time.Duration
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	nextSweep time.Time
+}
+
+// NewMemoryIdempotencyStore creates a store that keeps responses for the given
+// amount of time.
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		ttl:     ttl,
+		entries: map[string]memoryEntry{},
+	}
+}
+
+// DefaultIdempotencyStore is used by resources whose IdempotencyStore method
+// returns nil.
+var DefaultIdempotencyStore IdempotencyStore = NewMemoryIdempotencyStore(24 * time.Hour)
+
+func (s *MemoryIdempotencyStore) Lock(key, hash string) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired responses are removed every so often, rather than on every
+	// request, so that locking doesn't get slower as the store grows.
+	now := time.Now()
+	if now.After(s.nextSweep) {
+		for k, e := range s.entries {
+			if e.resp != nil && now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.nextSweep = now.Add(memorySweepInterval)
+	}
+
+	if e, ok := s.entries[key]; ok && (e.resp == nil || !now.After(e.expires)) {
+		if e.resp == nil {
+			return nil, ErrKeyInUse
+		}
+		return e.resp, nil
+	}
+
+	s.entries[key] = memoryEntry{}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Save(key string, resp *StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryEntry{resp: resp, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Unlock(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.resp == nil {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// A ResponseWriter that records the response as it's written.  The headers
+// are recorded after the wrapped writer's WriteHeader has run, so that they
+// include any that it sets, like the "ETag" from ETagWriter.
+type recordingWriter struct {
+	http.ResponseWriter
+	resp StoredResponse
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.resp.Status != 0 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.resp.Status = status
+	w.ResponseWriter.WriteHeader(status)
+	w.resp.Header = w.Header().Clone()
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.resp.Status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.resp.Body = append(w.resp.Body, b...)
+	return w.ResponseWriter.Write(b)
+}
+
+// Idempotent calls handler, unless the request has an "Idempotency-Key" header
+// whose response has already been stored, in which case the stored response
+// is written instead.  Reusing a key for a different request results in a
+// 422, and reusing it while the first request is in progress results in a
+// 409.  Responses with a 5xx status aren't stored, so that they can be
+// retried.  Request bodies larger than MaxIdempotentRequestSize get a 413.
+func Idempotent(store IdempotencyStore, w http.ResponseWriter, r *http.Request, handler func(w http.ResponseWriter)) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		handler(w)
+		return
+	}
+	if store == nil {
+		store = DefaultIdempotencyStore
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxIdempotentRequestSize))
+	if err != nil {
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "couldn't read request body", http.StatusBadRequest)
+		return
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	h.Write(body)
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	stored, err := store.Lock(key, hash)
+	switch {
+	case err == ErrKeyInUse:
+		http.Error(w, "a request with this Idempotency-Key is in progress", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	case stored != nil && stored.RequestHash != hash:
+		http.Error(w, "this Idempotency-Key was used for a different request", http.StatusUnprocessableEntity)
+		return
+	case stored != nil:
+		for k, v := range stored.Header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(stored.Status)
+		w.Write(stored.Body)
+		return
+	}
+
+	// The key is released if the handler panics.
+	rw := &recordingWriter{ResponseWriter: w, resp: StoredResponse{RequestHash: hash}}
+	completed := false
+	defer func() {
+		if !completed || rw.resp.Status >= 500 {
+			store.Unlock(key)
+			return
+		}
+		if rw.resp.Status == 0 {
+			rw.resp.Status = http.StatusOK
+			rw.resp.Header = w.Header().Clone()
+		}
+		store.Save(key, &rw.resp)
+	}()
+
+	handler(rw)
+	completed = true
+}
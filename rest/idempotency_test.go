@@ -0,0 +1,144 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotent(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Minute)
+	calls := 0
+	handler := func(w http.ResponseWriter) {
+		calls++
+		w.Header().Set("Location", "/api/foo/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}
+
+	post := func(key, body string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/api/foo", strings.NewReader(body))
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		Idempotent(store, w, r, handler)
+		return w
+	}
+
+	w := post("abc", "{}")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 1, calls)
+
+	// Retries get the stored response.
+	w = post("abc", "{}")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "created", w.Body.String())
+	assert.Equal(t, "/api/foo/1", w.Header().Get("Location"))
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	// A different body with the same key is rejected.
+	w = post("abc", `{"a": 1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, 1, calls)
+
+	// Requests without a key aren't affected.
+	post("", "{}")
+	post("", "{}")
+	assert.Equal(t, 3, calls)
+}
+
+func TestIdempotentWrappedWriter(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Minute)
+	v := &versioned{"1"}
+	handler := func(w http.ResponseWriter) {
+		v.Etag = "2"
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	post := func(wrap func(http.ResponseWriter) http.ResponseWriter) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest("POST", "/api/foo", strings.NewReader("{}"))
+		r.Header.Set("Idempotency-Key", "abc")
+		w := httptest.NewRecorder()
+		Idempotent(store, wrap(w), r, handler)
+		return w
+	}
+
+	w := post(func(w http.ResponseWriter) http.ResponseWriter { return ETagWriter(w, v) })
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+
+	// Headers set by the wrapped writer when the response is written are
+	// stored, so that a replay gets the same ones.
+	w = post(func(w http.ResponseWriter) http.ResponseWriter { return w })
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotentInProgressAndErrors(t *testing.T) {
+	store := NewMemoryIdempotencyStore(time.Minute)
+
+	_, err := store.Lock("abc", "hash")
+	assert.NoError(t, err)
+	_, err = store.Lock("abc", "hash")
+	assert.Equal(t, ErrKeyInUse, err)
+
+	r, _ := http.NewRequest("POST", "/api/foo", strings.NewReader("{}"))
+	r.Header.Set("Idempotency-Key", "abc")
+	w := httptest.NewRecorder()
+	Idempotent(store, w, r, func(w http.ResponseWriter) {})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Server errors aren't stored, so the request can be retried.
+	calls := 0
+	failing := func(w http.ResponseWriter) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	for i := 0; i < 2; i++ {
+		r, _ = http.NewRequest("POST", "/api/foo", strings.NewReader("{}"))
+		r.Header.Set("Idempotency-Key", "def")
+		Idempotent(store, httptest.NewRecorder(), r, failing)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotentLimits(t *testing.T) {
+	defer func(size int64) { MaxIdempotentRequestSize = size }(MaxIdempotentRequestSize)
+	MaxIdempotentRequestSize = 4
+
+	r, _ := http.NewRequest("POST", "/api/foo", strings.NewReader("too large"))
+	r.Header.Set("Idempotency-Key", "abc")
+	w := httptest.NewRecorder()
+	Idempotent(NewMemoryIdempotencyStore(time.Minute), w, r, func(w http.ResponseWriter) {
+		t.Error("the handler shouldn't be called")
+	})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	store := NewMemoryIdempotencyStore(-time.Second)
+	_, err := store.Lock("abc", "hash")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Save("abc", &StoredResponse{RequestHash: "hash"}))
+
+	// Expired responses aren't returned, even before they're swept.
+	stored, err := store.Lock("abc", "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+
+	// They're swept at most once per interval.
+	assert.NoError(t, store.Save("abc", &StoredResponse{RequestHash: "hash"}))
+	store.Lock("def", "hash")
+	assert.Len(t, store.entries, 2)
+
+	store.nextSweep = time.Time{}
+	store.Lock("ghi", "hash")
+	assert.Len(t, store.entries, 2)
+}
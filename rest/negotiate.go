@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/zenazn/goji/web"
+)
+
+type envKey int
+
+const (
+	requestCodecKey envKey = iota
+	responseCodecKey
+)
+
+// Returns whether the request has a body.
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody)
+}
+
+// Returns whether the request's body is a patch that ReadPatch understands,
+// which doesn't need a codec.
+func isPatch(r *http.Request) bool {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mt == MergePatchMediaType || mt == JSONPatchMediaType
+}
+
+// Negotiate chooses the codecs used to decode the request body and encode the
+// response, and stores them in the context for Decode and Respond.  If there
+// is no acceptable codec it writes a 406 or 415 response and returns false.
+// Bodies in one of the patch formats are left for ReadPatch, so they're always
+// accepted.
+func Negotiate(reg *Registry, c *web.C, w http.ResponseWriter, r *http.Request) bool {
+	supported := strings.Join(reg.MediaTypes(), ", ")
+
+	resp := reg.ForAccept(r.Header.Get("Accept"))
+	if resp == nil {
+		http.Error(w, fmt.Sprintf("none of the requested media types are supported: %s", supported),
+			http.StatusNotAcceptable)
+		return false
+	}
+
+	var req Codec
+	if hasBody(r) && !isPatch(r) {
+		req = reg.ForContentType(r.Header.Get("Content-Type"))
+		if req == nil {
+			http.Error(w, fmt.Sprintf("unsupported Content-Type, expected one of: %s", supported),
+				http.StatusUnsupportedMediaType)
+			return false
+		}
+	}
+
+	if c.Env == nil {
+		c.Env = map[interface{}]interface{}{}
+	}
+	c.Env[requestCodecKey] = req
+	c.Env[responseCodecKey] = resp
+	return true
+}
+
+// Returns the codec stored in the context under the given key, or JSON if
+// there isn't one.
+func codecFor(c web.C, key envKey) Codec {
+	if codec, ok := c.Env[key].(Codec); ok && codec != nil {
+		return codec
+	}
+	return JSON
+}
+
+// Decode decodes the request body into v using the codec chosen by Negotiate.
+// If content negotiation isn't enabled for the resource, JSON is used.
+func Decode(c web.C, r *http.Request, v interface{}) error {
+	return codecFor(c, requestCodecKey).Decode(r.Body, v)
+}
+
+// Respond writes v as the response with the given status code, using the codec
+// chosen by Negotiate.  If content negotiation isn't enabled for the resource,
+// JSON is used.
+func Respond(c web.C, w http.ResponseWriter, status int, v interface{}) error {
+	codec := codecFor(c, responseCodecKey)
+	w.Header().Set("Content-Type", codec.MediaType())
+	w.WriteHeader(status)
+	return codec.Encode(w, v)
+}
+
+// WriteResult writes the value returned from a typed handler.  A nil value is
+// written as a 204 No Content response, and a Versioned value sets the "ETag"
+// header.
+func WriteResult(c web.C, w http.ResponseWriter, status int, v interface{}) error {
+	if v == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if versioned, ok := v.(Versioned); ok {
+		w = ETagWriter(w, versioned)
+	}
+	return Respond(c, w, status, v)
+}
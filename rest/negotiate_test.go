@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenazn/goji/web"
+)
+
+func TestNegotiate(t *testing.T) {
+	reg := NewRegistry(versionedCodec{"1"})
+	negotiate := func(contentType, body string) (*httptest.ResponseRecorder, *http.Request, bool) {
+		r, _ := http.NewRequest("PATCH", "/api/foo/1", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		return w, r, Negotiate(reg, &web.C{}, w, r)
+	}
+
+	w, _, ok := negotiate("application/json", `{}`)
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	_, _, ok = negotiate("application/vnd.example+json; version=1", `{}`)
+	assert.True(t, ok)
+
+	// Patches are read by ReadPatch, whatever codecs the resource has.
+	_, r, ok := negotiate(MergePatchMediaType, `{"title":"x"}`)
+	if assert.True(t, ok) {
+		p, err := ReadPatch(r)
+		assert.NoError(t, err)
+		assert.Equal(t, MergePatch, p.Type)
+	}
+
+	_, r, ok = negotiate(JSONPatchMediaType, `[{"op":"remove","path":"/title"}]`)
+	if assert.True(t, ok) {
+		p, err := ReadPatch(r)
+		assert.NoError(t, err)
+		assert.Equal(t, JSONPatch, p.Type)
+	}
+}
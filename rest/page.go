@@ -0,0 +1,197 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zenazn/goji/web"
+)
+
+// PageOptions controls how a paginated collection is served.  Writing a typed
+// GetMany handler of the form:
+//
+//	func (f *FooResource) GetMany(ctx context.Context, page rest.PageRequest) (*rest.Page, error)
+//
+// enables pagination with DefaultPageOptions.  A resource can change them by
+// defining a method of the form:
+//
+//	func (f *FooResource) Pagination() rest.PageOptions
+type PageOptions struct {
+	// Limit used when the request doesn't specify one.  If it's zero, the
+	// limit from DefaultPageOptions is used.
+	DefaultLimit int
+
+	// Largest limit that a request may specify.
+	MaxLimit int
+
+	// Whether to wrap the items in an Envelope, instead of returning them
+	// directly and describing the page in headers.
+	Envelope bool
+}
+
+// DefaultPageOptions are used by resources without a Pagination method.
+var DefaultPageOptions = PageOptions{
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+// PageRequest describes the page of a collection that was requested, using
+// the "limit", "offset" and "cursor" query parameters.  A request uses either
+// an offset or a cursor, but not both.
+type PageRequest struct {
+	Limit  int
+	Offset int
+	Cursor string
+}
+
+// Page is the result of a paginated GetMany handler.
+type Page struct {
+	// The items on this page, which must be a slice.
+	Items interface{}
+
+	// Total number of items in the collection, or nil if it isn't known.
+	// Use Total to set it.
+	Total *int
+
+	// Cursor for the next page when using cursor-based pagination, or empty
+	// if this is the last page.
+	NextCursor string
+}
+
+// Total returns a pointer to n, for setting Page.Total.
+func Total(n int) *int {
+	return &n
+}
+
+// Envelope is written instead of the bare items when PageOptions.Envelope is
+// set.
+type Envelope struct {
+	Items      interface{} `json:"items" xml:"items"`
+	Total      *int        `json:"total,omitempty" xml:"total,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty" xml:"next_cursor,omitempty"`
+}
+
+// ParsePageRequest parses and validates the pagination query parameters.  The
+// returned error is an *Error with a 400 status.
+func ParsePageRequest(q url.Values, opts PageOptions) (PageRequest, error) {
+	req := PageRequest{Limit: opts.DefaultLimit, Cursor: q.Get("cursor")}
+	if req.Limit < 1 {
+		req.Limit = DefaultPageOptions.DefaultLimit
+	}
+
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return req, Errorf(http.StatusBadRequest, "limit must be a positive integer")
+		}
+		if opts.MaxLimit > 0 && n > opts.MaxLimit {
+			return req, Errorf(http.StatusBadRequest, "limit must be at most %d", opts.MaxLimit)
+		}
+		req.Limit = n
+	}
+
+	if s := q.Get("offset"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return req, Errorf(http.StatusBadRequest, "offset must be a non-negative integer")
+		}
+		if req.Cursor != "" {
+			return req, Errorf(http.StatusBadRequest, "offset and cursor can't be used together")
+		}
+		req.Offset = n
+	}
+
+	return req, nil
+}
+
+// Returns the URL of the current request with the given query parameters
+// replaced.
+func pageURL(r *http.Request, set map[string]string) string {
+	u := *r.URL
+	q := u.Query()
+	for k, v := range set {
+		q.Del(k)
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.RequestURI()
+}
+
+// Returns the links to other pages of the collection.  Pages of a request
+// without a limit can't be found from its offset, so it only links to the next
+// cursor.
+func pageLinks(r *http.Request, req PageRequest, page *Page, count int) []string {
+	links := []string{}
+	add := func(rel string, set map[string]string) {
+		set["limit"] = strconv.Itoa(req.Limit)
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(r, set), rel))
+	}
+
+	if req.Cursor != "" || page.NextCursor != "" || req.Limit < 1 {
+		if page.NextCursor != "" {
+			add("next", map[string]string{"cursor": page.NextCursor, "offset": ""})
+		}
+		return links
+	}
+
+	offset := func(n int) map[string]string {
+		return map[string]string{"offset": strconv.Itoa(n), "cursor": ""}
+	}
+
+	add("first", offset(0))
+	if req.Offset > 0 {
+		prev := req.Offset - req.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		add("prev", offset(prev))
+	}
+	if page.Total != nil {
+		total := *page.Total
+		if req.Offset+req.Limit < total {
+			add("next", offset(req.Offset+req.Limit))
+		}
+		last := 0
+		if total > 0 {
+			last = (total - 1) / req.Limit * req.Limit
+		}
+		add("last", offset(last))
+	} else if count >= req.Limit {
+		add("next", offset(req.Offset+req.Limit))
+	}
+	return links
+}
+
+// WritePage writes the response for a page returned from a typed GetMany
+// handler.  The "Link" header refers to the neighbouring pages and the
+// "X-Total-Count" header holds the size of the collection, if it's known.
+func WritePage(c web.C, w http.ResponseWriter, r *http.Request, req PageRequest, page *Page, opts PageOptions) error {
+	if page == nil {
+		page = &Page{}
+	}
+
+	count := 0
+	if v := reflect.ValueOf(page.Items); v.Kind() == reflect.Slice {
+		count = v.Len()
+	}
+
+	if links := pageLinks(r, req, page, count); len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	if page.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*page.Total))
+	}
+
+	if !opts.Envelope {
+		return Respond(c, w, http.StatusOK, page.Items)
+	}
+
+	env := Envelope{Items: page.Items, Total: page.Total, NextCursor: page.NextCursor}
+	return Respond(c, w, http.StatusOK, env)
+}
@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zenazn/goji/web"
+)
+
+func TestParsePageRequest(t *testing.T) {
+	opts := PageOptions{DefaultLimit: 10, MaxLimit: 50}
+	parse := func(q string) (PageRequest, error) {
+		v, _ := url.ParseQuery(q)
+		return ParsePageRequest(v, opts)
+	}
+
+	req, err := parse("")
+	assert.NoError(t, err)
+	assert.Equal(t, PageRequest{Limit: 10}, req)
+
+	req, err = parse("limit=5&offset=15")
+	assert.NoError(t, err)
+	assert.Equal(t, PageRequest{Limit: 5, Offset: 15}, req)
+
+	req, err = parse("cursor=abc")
+	assert.NoError(t, err)
+	assert.Equal(t, PageRequest{Limit: 10, Cursor: "abc"}, req)
+
+	// A zero default limit uses the default from DefaultPageOptions.
+	req, err = ParsePageRequest(url.Values{}, PageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PageRequest{Limit: 20}, req)
+
+	for _, q := range []string{"limit=0", "limit=51", "limit=x", "offset=-1", "offset=1&cursor=abc"} {
+		_, err = parse(q)
+		if assert.Error(t, err, q) {
+			assert.Equal(t, http.StatusBadRequest, err.(*Error).Status)
+		}
+	}
+}
+
+func TestWritePage(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/api/foo?limit=10&offset=10&status=open", nil)
+	req := PageRequest{Limit: 10, Offset: 10}
+
+	w := httptest.NewRecorder()
+	err := WritePage(web.C{}, w, r, req, &Page{Items: []int{1, 2}, Total: Total(35)}, PageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "35", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</api/foo?limit=10&offset=0&status=open>; rel="first", `+
+		`</api/foo?limit=10&offset=0&status=open>; rel="prev", `+
+		`</api/foo?limit=10&offset=20&status=open>; rel="next", `+
+		`</api/foo?limit=10&offset=30&status=open>; rel="last"`, w.Header().Get("Link"))
+	assert.Equal(t, "[1,2]\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	err = WritePage(web.C{}, w, r, PageRequest{Limit: 10}, &Page{Items: []int{1}, NextCursor: "xyz"},
+		PageOptions{Envelope: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</api/foo?cursor=xyz&limit=10&status=open>; rel="next"`, w.Header().Get("Link"))
+	assert.Equal(t, `{"items":[1],"next_cursor":"xyz"}`+"\n", w.Body.String())
+
+	// A request without a limit doesn't divide by zero, or link to the same
+	// page again.
+	w = httptest.NewRecorder()
+	err = WritePage(web.C{}, w, r, PageRequest{Offset: 10}, &Page{Items: []int{1}, Total: Total(35)}, PageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", w.Header().Get("Link"))
+
+	w = httptest.NewRecorder()
+	err = WritePage(web.C{}, w, r, PageRequest{Offset: 10}, &Page{Items: []int{}}, PageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", w.Header().Get("Link"))
+
+	// A page without a total still links to the next one if it's full.
+	w = httptest.NewRecorder()
+	err = WritePage(web.C{}, w, r, req, &Page{Items: make([]int, 10)}, PageOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</api/foo?limit=10&offset=0&status=open>; rel="first", `+
+		`</api/foo?limit=10&offset=0&status=open>; rel="prev", `+
+		`</api/foo?limit=10&offset=20&status=open>; rel="next"`, w.Header().Get("Link"))
+
+	// An empty collection has a total of zero.
+	w = httptest.NewRecorder()
+	err = WritePage(web.C{}, w, r, PageRequest{Limit: 10}, &Page{Items: []int{}, Total: Total(0)}, PageOptions{Envelope: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", w.Header().Get("X-Total-Count"))
+	assert.Equal(t, `{"items":[],"total":0}`+"\n", w.Body.String())
+}
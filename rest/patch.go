@@ -0,0 +1,371 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// The media types of the supported patch formats.
+const (
+	MergePatchMediaType = "application/merge-patch+json"
+	JSONPatchMediaType  = "application/json-patch+json"
+)
+
+// PatchType is the format of a patch.
+type PatchType int
+
+const (
+	// A JSON Merge Patch, as defined by RFC 7396.
+	MergePatch PatchType = iota + 1
+
+	// A JSON Patch, as defined by RFC 6902.
+	JSONPatch
+)
+
+// PatchOp is a single operation of a JSON Patch.
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is the body of a PATCH request, which is passed to typed Patch
+// handlers of the form:
+//
+//	func (f *FooResource) Patch(ctx context.Context, patch *rest.Patch) (interface{}, error)
+//
+// If the resource also has a typed GetOne handler, the patch is applied to the
+// object that it returns before the Patch handler is called, and the result
+// is available in Document.
+type Patch struct {
+	Type PatchType
+
+	// The merge patch, if Type is MergePatch.
+	Merge json.RawMessage
+
+	// The operations, if Type is JSONPatch.
+	Ops []PatchOp
+
+	// The current object with the patch applied, if it has been loaded.
+	Document json.RawMessage
+}
+
+// ReadPatch reads the body of a PATCH request, using the "Content-Type" header
+// to determine its format.  The returned error is an *Error with a 415 status
+// for unsupported formats, or a 400 status for malformed bodies.
+func ReadPatch(r *http.Request) (*Patch, error) {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	p := &Patch{}
+	switch mt {
+	case MergePatchMediaType:
+		p.Type = MergePatch
+	case JSONPatchMediaType:
+		p.Type = JSONPatch
+	default:
+		return nil, Errorf(http.StatusUnsupportedMediaType,
+			"unsupported patch format, expected one of: %s, %s", MergePatchMediaType, JSONPatchMediaType)
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, Errorf(http.StatusBadRequest, "couldn't read patch: %s", err)
+	}
+
+	if p.Type == MergePatch {
+		var v interface{}
+		err = json.Unmarshal(body, &v)
+		p.Merge = body
+	} else {
+		err = json.Unmarshal(body, &p.Ops)
+	}
+	if err != nil {
+		return nil, Errorf(http.StatusBadRequest, "malformed patch: %s", err)
+	}
+	return p, nil
+}
+
+// Apply applies the patch to the given JSON document, returning the result.
+// The returned error is an *Error with a 409 status if a "test" operation
+// fails, or a 422 status if the patch can't be applied.
+func (p *Patch) Apply(doc []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, err
+	}
+
+	switch p.Type {
+	case MergePatch:
+		var patch interface{}
+		if err := json.Unmarshal(p.Merge, &patch); err != nil {
+			return nil, Errorf(http.StatusBadRequest, "malformed patch: %s", err)
+		}
+		target = mergePatch(target, patch)
+
+	case JSONPatch:
+		for i, op := range p.Ops {
+			var err error
+			if target, err = applyOp(target, op); err != nil {
+				if e, ok := err.(*Error); ok {
+					e.Message = "operation " + strconv.Itoa(i) + ": " + e.Message
+				}
+				return nil, err
+			}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// ApplyTo applies the patch to the JSON encoding of current, and stores the
+// result in Document.
+func (p *Patch) ApplyTo(current interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+
+	p.Document, err = p.Apply(doc)
+	return err
+}
+
+// Decode decodes the patched object into v.  If the patch hasn't been applied
+// to the current object, a merge patch is decoded on top of v, so that v
+// should already hold the current object; a JSON Patch can't be decoded
+// without a Document.
+func (p *Patch) Decode(v interface{}) error {
+	switch {
+	case p.Document != nil:
+		return json.Unmarshal(p.Document, v)
+	case p.Type == MergePatch:
+		return json.Unmarshal(p.Merge, v)
+	}
+	return Errorf(http.StatusUnprocessableEntity, "a JSON Patch can't be decoded without the current object")
+}
+
+// Applies a merge patch to a decoded JSON value, as described by RFC 7396.
+func mergePatch(target, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = map[string]interface{}{}
+	}
+	for k, v := range pm {
+		if v == nil {
+			delete(tm, k)
+		} else {
+			tm[k] = mergePatch(tm[k], v)
+		}
+	}
+	return tm
+}
+
+// Splits a JSON Pointer (RFC 6901) into its unescaped reference tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return []string{}, nil
+	}
+	if ptr[0] != '/' {
+		return nil, Errorf(http.StatusUnprocessableEntity, "invalid path %q", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// Parses an array index from a reference token.  If end is true, the index may
+// be one past the last element, which is also referred to by "-".
+func arrayIndex(token string, n int, end bool) (int, error) {
+	if end && token == "-" {
+		return n, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') || i > n || (i == n && !end) {
+		return 0, Errorf(http.StatusUnprocessableEntity, "invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func notFound(tokens []string) error {
+	return Errorf(http.StatusUnprocessableEntity, "path %q doesn't exist", "/"+strings.Join(tokens, "/"))
+}
+
+// Returns the value at the given location.
+func getAt(doc interface{}, tokens []string) (interface{}, error) {
+	for i, t := range tokens {
+		switch d := doc.(type) {
+		case map[string]interface{}:
+			v, ok := d[t]
+			if !ok {
+				return nil, notFound(tokens[:i+1])
+			}
+			doc = v
+		case []interface{}:
+			idx, err := arrayIndex(t, len(d), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = d[idx]
+		default:
+			return nil, notFound(tokens[:i+1])
+		}
+	}
+	return doc, nil
+}
+
+// Replaces the parent of the given location with the result of fn, which is
+// called with the parent and the final reference token.  Returns the updated
+// document.
+func updateAt(doc interface{}, tokens []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+
+	child, err := getAt(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+	child, err = updateAt(child, tokens[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		d[tokens[0]] = child
+	case []interface{}:
+		idx, _ := arrayIndex(tokens[0], len(d), false)
+		d[idx] = child
+	}
+	return doc, nil
+}
+
+func addAt(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	return updateAt(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch d := parent.(type) {
+		case map[string]interface{}:
+			d[key] = value
+			return d, nil
+		case []interface{}:
+			idx, err := arrayIndex(key, len(d), true)
+			if err != nil {
+				return nil, err
+			}
+			d = append(d, nil)
+			copy(d[idx+1:], d[idx:])
+			d[idx] = value
+			return d, nil
+		}
+		return nil, notFound(tokens)
+	})
+}
+
+func removeAt(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, Errorf(http.StatusUnprocessableEntity, "can't remove the whole document")
+	}
+
+	return updateAt(doc, tokens, func(parent interface{}, key string) (interface{}, error) {
+		switch d := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := d[key]; !ok {
+				return nil, notFound(tokens)
+			}
+			delete(d, key)
+			return d, nil
+		case []interface{}:
+			idx, err := arrayIndex(key, len(d), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(d[:idx], d[idx+1:]...), nil
+		}
+		return nil, notFound(tokens)
+	})
+}
+
+// Applies a single JSON Patch operation to a decoded JSON value.
+func applyOp(doc interface{}, op PatchOp) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, Errorf(http.StatusUnprocessableEntity, "'%s' requires a value", op.Op)
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, Errorf(http.StatusBadRequest, "malformed value: %s", err)
+		}
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = getAt(doc, from); err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, Errorf(http.StatusUnprocessableEntity, "can't move %q into itself", op.From)
+			}
+			if doc, err = removeAt(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			// Copy the value, so that later operations don't change both.
+			b, _ := json.Marshal(value)
+			json.Unmarshal(b, &value)
+		}
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addAt(doc, path, value)
+	case "remove":
+		return removeAt(doc, path)
+	case "replace":
+		if _, err := getAt(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = removeAt(doc, path); err != nil {
+			return nil, err
+		}
+		return addAt(doc, path, value)
+	case "test":
+		actual, err := getAt(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(actual, value) {
+			return nil, Errorf(http.StatusConflict, "test of %q failed", op.Path)
+		}
+		return doc, nil
+	}
+	return nil, Errorf(http.StatusUnprocessableEntity, "unknown operation '%s'", op.Op)
+}
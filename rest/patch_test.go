@@ -0,0 +1,120 @@
+package rest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readPatch(t *testing.T, contentType, body string) *Patch {
+	r, _ := http.NewRequest("PATCH", "/api/foo/1", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+
+	p, err := ReadPatch(r)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestMergePatch(t *testing.T) {
+	// This is the example from RFC 7396, section 3.
+	p := readPatch(t, MergePatchMediaType, `{
+		"title": "Hello!",
+		"phoneNumber": "+01-123-456-7890",
+		"author": {"familyName": null},
+		"tags": ["example"]
+	}`)
+	assert.Equal(t, MergePatch, p.Type)
+
+	out, err := p.Apply([]byte(`{
+		"title": "Goodbye!",
+		"author": {"givenName": "John", "familyName": "Doe"},
+		"tags": ["example", "sample"],
+		"content": "This will be unchanged"
+	}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"title": "Hello!",
+		"author": {"givenName": "John"},
+		"tags": ["example"],
+		"content": "This will be unchanged",
+		"phoneNumber": "+01-123-456-7890"
+	}`, string(out))
+}
+
+func TestJSONPatch(t *testing.T) {
+	p := readPatch(t, JSONPatchMediaType, `[
+		{"op": "test", "path": "/a/b/c", "value": "foo"},
+		{"op": "remove", "path": "/a/b/c"},
+		{"op": "add", "path": "/a/b/c", "value": ["foo", "bar"]},
+		{"op": "replace", "path": "/a/b/c", "value": 42},
+		{"op": "move", "from": "/a/b/c", "path": "/a/b/d"},
+		{"op": "copy", "from": "/a/b/d", "path": "/a/b/e"},
+		{"op": "add", "path": "/list/1", "value": "x"},
+		{"op": "add", "path": "/list/-", "value": "z"},
+		{"op": "remove", "path": "/list/0"},
+		{"op": "add", "path": "/k~1l", "value": true}
+	]`)
+	assert.Equal(t, JSONPatch, p.Type)
+
+	out, err := p.Apply([]byte(`{"a": {"b": {"c": "foo"}}, "list": ["w", "y"]}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"a": {"b": {"d": 42, "e": 42}}, "list": ["x", "y", "z"], "k/l": true}`, string(out))
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	doc := []byte(`{"a": [1, 2], "b": "foo"}`)
+	for body, status := range map[string]int{
+		`[{"op": "test", "path": "/b", "value": "bar"}]`:   http.StatusConflict,
+		`[{"op": "remove", "path": "/c"}]`:                 http.StatusUnprocessableEntity,
+		`[{"op": "replace", "path": "/a/2", "value": 3}]`:  http.StatusUnprocessableEntity,
+		`[{"op": "add", "path": "/a/01", "value": 3}]`:     http.StatusUnprocessableEntity,
+		`[{"op": "add", "path": "/x/y", "value": 3}]`:      http.StatusUnprocessableEntity,
+		`[{"op": "add", "path": "/x"}]`:                    http.StatusUnprocessableEntity,
+		`[{"op": "move", "from": "/a", "path": "/a/0"}]`:   http.StatusUnprocessableEntity,
+		`[{"op": "frobnicate", "path": "/a", "value": 1}]`: http.StatusUnprocessableEntity,
+		`[{"op": "test", "path": "a", "value": [1, 2]}]`:   http.StatusUnprocessableEntity,
+	} {
+		_, err := readPatch(t, JSONPatchMediaType, body).Apply(doc)
+		if assert.Error(t, err, body) {
+			assert.Equal(t, status, err.(*Error).Status, body)
+		}
+	}
+}
+
+func TestReadPatchErrors(t *testing.T) {
+	r, _ := http.NewRequest("PATCH", "/api/foo/1", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	_, err := ReadPatch(r)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, err.(*Error).Status)
+	}
+
+	r, _ = http.NewRequest("PATCH", "/api/foo/1", strings.NewReader(`{"op": "add"}`))
+	r.Header.Set("Content-Type", JSONPatchMediaType)
+	_, err = ReadPatch(r)
+	if assert.Error(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.(*Error).Status)
+	}
+}
+
+func TestPatchDecode(t *testing.T) {
+	type obj struct {
+		A string `json:"a"`
+		B string `json:"b"`
+	}
+
+	// Without a document, a merge patch is decoded on top of the value.
+	p := &Patch{Type: MergePatch, Merge: []byte(`{"b": "new"}`)}
+	v := obj{A: "old", B: "old"}
+	assert.NoError(t, p.Decode(&v))
+	assert.Equal(t, obj{A: "old", B: "new"}, v)
+
+	p = &Patch{Type: JSONPatch, Ops: []PatchOp{{Op: "replace", Path: "/a", Value: []byte(`"new"`)}}}
+	assert.Error(t, p.Decode(&v))
+
+	assert.NoError(t, p.ApplyTo(obj{A: "old", B: "old"}))
+	assert.NoError(t, p.Decode(&v))
+	assert.Equal(t, obj{A: "new", B: "old"}, v)
+}
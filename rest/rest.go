@@ -0,0 +1,4 @@
+// Package rest contains the runtime support for code generated by sleepywolf.
+// Resources use the types in this package to declare options, and the
+// generated registration functions call into it while serving requests.
+package rest
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/andrew-d/sleepywolf/generator"
+)
+
+// The flags for generating code that "sleepywolf routes" also accepts, since
+// they change which routes are found.
+var routesGeneratorFlags = []string{
+	"v", "keep", "prefix", "batch", "verbs", "config", "templates", "order",
+	"tags", "mod", "timeout", "cachedir", "nocache",
+}
+
+// Returns the flags of "sleepywolf routes", which share their values with
+// the generator's flags of the same name.
+func routesFlagSet(errorHandling flag.ErrorHandling) *flag.FlagSet {
+	fs := flag.NewFlagSet("routes", errorHandling)
+	for _, name := range routesGeneratorFlags {
+		f := flag.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s routes:\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\t%s routes [options] input_file...\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "%s routes prints the routes that the generated code registers\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// Implements "sleepywolf routes", which finds the resources in the input
+// files in the same way as generating them, and prints their routes instead.
+// It has its own flags, along with the flags for generating code that affect
+// the routes, like -prefix and -config.
+func routesMain(args []string) {
+	fs := routesFlagSet(flag.ExitOnError)
+	format := fs.String("format", "table", "output format: \"table\", \"json\" or \"csv\"")
+	methods := fs.String("method", "", "only print routes with these comma-separated HTTP methods")
+	pathPrefix := fs.String("path", "", "only print routes whose paths start with this")
+	fs.Parse(args)
+	flags = fs
+
+	var write func(io.Writer, []generator.Route) error
+	switch *format {
+	case "table":
+		write = writeRoutesTable
+	case "json":
+		write = writeRoutesJSON
+	case "csv":
+		write = writeRoutesCSV
+	default:
+		fatalf("unknown format %q\n", *format)
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	opts := generator.Options{
+		KeepTemp: *keepGenerated,
+		Mod:      *mod,
+		Timeout:  *timeout,
+		CacheDir: *cacheDir,
+		NoCache:  *noCache,
+	}
+	if *tags != "" {
+		opts.Tags = strings.Split(*tags, ",")
+	}
+
+	pkgs, err := loadPackages(fs.Args(), opts)
+	if err != nil {
+		fatalf("%s\n", err)
+	}
+
+	inputs := []generator.Input{}
+	for _, p := range pkgs {
+		if p.Err != nil {
+			fatalf("%s: %s\n", p.Dir, p.Err)
+		}
+		if *verbose {
+			p.Opts.Log = os.Stderr
+		}
+		inputs = append(inputs, generator.Input{Patterns: p.Inputs, Options: p.Opts})
+	}
+
+	models, errs := generator.LoadAll(inputs)
+	routes := []generator.Route{}
+	for i, model := range models {
+		if errs[i] != nil {
+			fatalf("%s\n", errs[i])
+		}
+		table, err := generator.RouteTable(model)
+		if err != nil {
+			fatalf("%s\n", err)
+		}
+
+		routes = append(routes, filterRoutes(table, *methods, *pathPrefix)...)
+	}
+
+	if err := write(os.Stdout, routes); err != nil {
+		fatalf("couldn't write routes: %s\n", err)
+	}
+}
+
+// Returns the routes with one of the given comma-separated methods (or any
+// method, if there aren't any) and a path that starts with the given prefix.
+func filterRoutes(routes []generator.Route, methods, pathPrefix string) []generator.Route {
+	allowed := map[string]bool{}
+	for _, method := range strings.Split(methods, ",") {
+		if method = strings.TrimSpace(method); method != "" {
+			allowed[strings.ToUpper(method)] = true
+		}
+	}
+
+	filtered := []generator.Route{}
+	for _, route := range routes {
+		if len(allowed) > 0 && !allowed[route.Method] {
+			continue
+		}
+		if !strings.HasPrefix(route.Path, pathPrefix) {
+			continue
+		}
+		filtered = append(filtered, route)
+	}
+	return filtered
+}
+
+// Returns the hooks that run for a route, as they're printed in every format
+// other than JSON.
+func routeHooks(route generator.Route) string {
+	return strings.Join(route.Hooks, ", ")
+}
+
+func writeRoutesTable(w io.Writer, routes []generator.Route) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "METHOD\tPATH\tRESOURCE\tHANDLER\tHOOKS\tSOURCE\n")
+	for _, route := range routes {
+		resource, hooks := route.Resource, routeHooks(route)
+		if resource == "" {
+			resource = "-"
+		}
+		if hooks == "" {
+			hooks = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", route.Method, route.Path,
+			resource, route.Handler, hooks, route.Source)
+	}
+	return tw.Flush()
+}
+
+func writeRoutesJSON(w io.Writer, routes []generator.Route) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(routes)
+}
+
+func writeRoutesCSV(w io.Writer, routes []generator.Route) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"method", "path", "resource", "handler", "hooks", "source"})
+	for _, route := range routes {
+		cw.Write([]string{route.Method, route.Path, route.Resource, route.Handler,
+			routeHooks(route), route.Source})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/sleepywolf/generator"
+)
+
+func TestWriteRoutes(t *testing.T) {
+	routes := []generator.Route{{
+		Method:   "GET",
+		Path:     "/api/todos/:id",
+		Resource: "TodosResource",
+		Handler:  "GetOne",
+		Hooks:    []string{"BeforeAll", "BeforeOne"},
+		Source:   "todos.go:31:24",
+	}, {
+		Method:  "POST",
+		Path:    "/api/batch",
+		Handler: "rest.BatchHandler",
+		Hooks:   []string{},
+		Source:  "todos.go",
+	}}
+
+	// The table and CSV list hooks in the same way.
+	table := bytes.Buffer{}
+	assert.NoError(t, writeRoutesTable(&table, routes))
+	lines := strings.Split(table.String(), "\n")
+	assert.Equal(t, []string{"GET", "/api/todos/:id", "TodosResource", "GetOne", "BeforeAll,", "BeforeOne", "todos.go:31:24"},
+		strings.Fields(lines[1]))
+	assert.Equal(t, []string{"POST", "/api/batch", "-", "rest.BatchHandler", "-", "todos.go"},
+		strings.Fields(lines[2]))
+
+	csv := bytes.Buffer{}
+	assert.NoError(t, writeRoutesCSV(&csv, routes))
+	assert.Equal(t, "method,path,resource,handler,hooks,source\n"+
+		"GET,/api/todos/:id,TodosResource,GetOne,\"BeforeAll, BeforeOne\",todos.go:31:24\n"+
+		"POST,/api/batch,,rest.BatchHandler,,todos.go\n", csv.String())
+}
+
+func TestRoutesFlagSet(t *testing.T) {
+	defer func(p string, n bool) { *prefix, *noCache = p, n }(*prefix, *noCache)
+
+	// The generator's flags that affect routes set the same values, and the
+	// others aren't accepted.
+	fs := routesFlagSet(flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	assert.NoError(t, fs.Parse([]string{"-prefix", "/v2", "-nocache", "todos.go"}))
+	assert.Equal(t, "/v2", *prefix)
+	assert.Equal(t, []string{"todos.go"}, fs.Args())
+
+	for _, name := range []string{"-check", "-watch", "-force", "-j=2", "-stdout"} {
+		fs := routesFlagSet(flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		assert.Error(t, fs.Parse([]string{name, "todos.go"}), name)
+	}
+}
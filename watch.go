@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/andrew-d/sleepywolf/generator"
+)
+
+// How long to wait after a file changes before regenerating, so that saving
+// several files at once only regenerates once.
+const watchDebounce = 250 * time.Millisecond
+
+// The state of -watch.
+type watcher struct {
+	// The options for each input
+	opts map[string]generator.Options
+}
+
+// Prints a message with the time that it happened.
+func watchf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+}
+
+// Watches the given packages, and any templates that they use, and
+// regenerates the output for each input file when they change.  Errors are
+// printed, and it keeps watching; it only returns if it can't watch the
+// files.
+func watch(pkgs []*pkg) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("couldn't watch files: %s", err)
+	}
+	defer fsw.Close()
+
+	// The inputs that are affected by changes in each directory that's
+	// watched.  Changing a template affects every package that uses it.
+	w := &watcher{opts: map[string]generator.Options{}}
+	inputs := []string{}
+	dirs := map[string][]string{}
+	for _, p := range pkgs {
+		if p.Err != nil {
+			watchf("%s: %s", p.Dir, p.Err)
+			continue
+		}
+
+		opts := p.Opts
+		if *verbose {
+			opts.Log = os.Stderr
+		}
+		for _, input := range p.Inputs {
+			w.opts[input] = opts
+		}
+		inputs = append(inputs, p.Inputs...)
+		dirs[p.Dir] = append(dirs[p.Dir], p.Inputs...)
+		if p.Opts.Templates != "" {
+			templates := filepath.Clean(p.Opts.Templates)
+			dirs[templates] = append(dirs[templates], p.Inputs...)
+		}
+	}
+	watched := []string{}
+	for dir := range dirs {
+		if err := fsw.Add(dir); err != nil {
+			return fmt.Errorf("couldn't watch %s: %s", dir, err)
+		}
+		watched = append(watched, dir)
+	}
+	sort.Strings(watched)
+
+	w.update(inputs)
+	watchf("Watching %s for changes", strings.Join(watched, ", "))
+
+	changed := map[string]bool{}
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if !watchable(event.Name) {
+				continue
+			}
+			for _, input := range dirs[filepath.Clean(filepath.Dir(event.Name))] {
+				changed[input] = true
+			}
+			debounce = time.After(watchDebounce)
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			watchf("Error watching files: %s", err)
+
+		case <-debounce:
+			debounce = nil
+			update := []string{}
+			for _, input := range inputs {
+				if changed[input] {
+					update = append(update, input)
+				}
+			}
+			changed = map[string]bool{}
+			w.update(update)
+		}
+	}
+}
+
+// Returns whether a change to the file with the given name could change the
+// generated code.  Tests and temporary files (which start with a dot) can't.
+func watchable(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") || strings.HasSuffix(base, "_test.go") {
+		return false
+	}
+	return strings.HasSuffix(base, ".go") || strings.HasSuffix(base, ".tmpl")
+}
+
+// Returns the given inputs whose output isn't up to date.  Errors are
+// printed, and those inputs are left out.
+func (w *watcher) stale(inputs []string) []string {
+	stale := []string{}
+	for _, input := range inputs {
+		upToDate, err := generator.UpToDate(input, w.opts[input])
+		if err != nil {
+			watchf("%s", &generator.Error{Op: generator.OpParse, Path: input, Err: err})
+			continue
+		}
+		if !upToDate {
+			stale = append(stale, input)
+		}
+	}
+	return stale
+}
+
+// Regenerates the output for each of the given inputs that isn't up to date.
+// Any change to the input's package, even to a function body, can change the
+// output (e.g. the ID type returned by IDType), so the whole fingerprint is
+// compared.
+func (w *watcher) update(inputs []string) {
+	// Each input is generated on its own, so that an error in one package
+	// doesn't stop the others from being updated.  An input that fails isn't
+	// written, so it's tried again on the next change.
+	for _, input := range w.stale(inputs) {
+		start := time.Now()
+		_, files, pluginFiles, err := generate([]string{input}, w.opts[input], os.Stderr)
+		if err == nil {
+			for path, contents := range pluginFiles {
+				files[path] = contents
+			}
+			err = writeError(generator.WriteFiles(files, *force))
+		}
+		if err != nil {
+			watchf("%s", err)
+			continue
+		}
+
+		watchf("Generated %s in %s", (&generator.File{Path: input}).Output(),
+			time.Since(start).Round(time.Millisecond))
+	}
+}
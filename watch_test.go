@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/andrew-d/sleepywolf/generator"
+)
+
+func TestWatcherStale(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "todos.go")
+	write := func(idType string) {
+		contents := "package todos\n\ntype TodosResource struct{}\n\n" +
+			"func (t *TodosResource) IDType() string { return \"" + idType + "\" }\n"
+		assert.NoError(t, os.WriteFile(input, []byte(contents), 0644))
+	}
+
+	w := &watcher{opts: map[string]generator.Options{input: {}}}
+	write("int")
+	assert.Equal(t, []string{input}, w.stale([]string{input}))
+
+	fingerprint, err := generator.Fingerprint(input, generator.Options{})
+	assert.NoError(t, err)
+	output := "// Code generated by sleepywolf; DO NOT EDIT.\n// Input: " + fingerprint + "\n\npackage todos\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "todos_goji.go"), []byte(output), 0644))
+	assert.Equal(t, []string{}, w.stale([]string{input}))
+
+	// Changing only the body of IDType changes the generated routes, so the
+	// output has to be generated again.
+	write("uuid")
+	assert.Equal(t, []string{input}, w.stale([]string{input}))
+}